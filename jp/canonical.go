@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var ErrNotCanonicalizable = errors.New("document has no canonical form")
+
+// Canonicalize writes v to w in the RFC 8785 JSON Canonicalization Scheme
+// form: no whitespace, members sorted by the UTF-16 code units of their keys,
+// numbers written the way ECMAScript would and strings minimally escaped.
+func Canonicalize(w io.Writer, v Value) error {
+	buf, err := appendCanonical(nil, v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+
+	return err
+}
+
+func CanonicalBytes(v Value) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Canonicalize(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CanonicalDigest is the SHA-256 digest of the canonical form of v, so two
+// documents that differ only in layout, member order or spelling of their
+// numbers and strings hash the same.
+func CanonicalDigest(v Value) ([sha256.Size]byte, error) {
+	buf, err := CanonicalBytes(v)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(buf), nil
+}
+
+func appendCanonical(buf []byte, v Value) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case *Object:
+		members := slices.Clone(v.Members)
+		slices.SortFunc(members, func(a, b Member) int {
+			return compareUTF16(a.Key, b.Key)
+		})
+		buf = append(buf, '{')
+		for i, m := range members {
+			if i > 0 {
+				if members[i-1].Key == m.Key {
+					return nil, fmt.Errorf("%w: duplicate key %q", ErrNotCanonicalizable, m.Key)
+				}
+				buf = append(buf, ',')
+			}
+			buf = appendString(buf, m.Key)
+			buf = append(buf, ':')
+			if buf, err = appendCanonical(buf, m.Value); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, '}'), nil
+	case *Array:
+		buf = append(buf, '[')
+		for i, e := range v.Elems {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			if buf, err = appendCanonical(buf, e); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, ']'), nil
+	case *Number:
+		f, err := strconv.ParseFloat(v.Literal, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("%w: %s is not a finite double", ErrNotCanonicalizable, v.Literal)
+		}
+		return append(buf, formatES(f, 64)...), nil
+	}
+	return appendScalar(buf, v, FormatOptions{}), nil
+}
+
+// formatES renders f as ECMAScript's Number.prototype.toString does, using
+// the shortest digits that round trip for a float of the given bit size.
+func formatES(f float64, bitSize int) string {
+	if f == 0 {
+		return "0"
+	}
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+
+	// Go gives us the shortest digits that round trip, d.ddde±x, from which
+	// ECMAScript's choice of layout follows.
+	sci := strconv.FormatFloat(f, 'e', -1, bitSize)
+	mant, exp, _ := strings.Cut(sci, "e")
+	digits := strings.Replace(mant, ".", "", 1)
+	e, _ := strconv.Atoi(exp)
+	k, n := len(digits), e+1
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits
+	}
+
+	expSign := "+"
+	if n-1 < 0 {
+		expSign = "-"
+	}
+	frac := ""
+	if k > 1 {
+		frac = "." + digits[1:]
+	}
+	return fmt.Sprintf("%s%c%se%s%d", sign, digits[0], frac, expSign, abs(n-1))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// compareUTF16 orders strings by their UTF-16 code units, which differs from
+// Go's byte order for characters beyond the basic multilingual plane.
+func compareUTF16(a, b string) int {
+	return slices.Compare(utf16.Encode([]rune(a)), utf16.Encode([]rune(b)))
+}
@@ -0,0 +1,144 @@
+package main_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestCanonicalize(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		want string
+	}{
+		{
+			desc: "rfc 8785 example",
+			data: `{
+				"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+				"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+				"literals": [null, true, false]
+			}`,
+			want: `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],` +
+				`"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			desc: "utf-16 key order",
+			data: `{
+				"\u20ac": "Euro Sign",
+				"\r": "Carriage Return",
+				"\ufb33": "Hebrew Letter Dalet With Dagesh",
+				"1": "One",
+				"\ud83d\ude00": "Emoji: Grinning Face",
+				"\u0080": "Control",
+				"\u00f6": "Latin Small Letter O With Diaeresis"
+			}`,
+			want: `{"\r":"Carriage Return","1":"One","` + "\u0080" + `":"Control",` +
+				`"ö":"Latin Small Letter O With Diaeresis","€":"Euro Sign",` +
+				`"😀":"Emoji: Grinning Face","` + "\ufb33" + `":"Hebrew Letter Dalet With Dagesh"}`,
+		},
+		{desc: "nested", data: `[{"b": [], "a": {"d": 1, "c": 2}}]`, want: `[{"a":{"c":2,"d":1},"b":[]}]`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParser(strings.NewReader(tC.data))
+			v, err := p.Parse()
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			got, err := jp.CanonicalBytes(v)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tC.want {
+				t.Fatalf("Bad canonical form, got\n%s\nwant\n%s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalNumbers(t *testing.T) {
+	testCases := []struct {
+		lit  string
+		want string
+	}{
+		{lit: "0", want: "0"},
+		{lit: "-0", want: "0"},
+		{lit: "0.0e10", want: "0"},
+		{lit: "1", want: "1"},
+		{lit: "-1.50", want: "-1.5"},
+		{lit: "100", want: "100"},
+		{lit: "1e20", want: "100000000000000000000"},
+		{lit: "1e21", want: "1e+21"},
+		{lit: "123456789012345678901", want: "123456789012345680000"},
+		{lit: "0.000001", want: "0.000001"},
+		{lit: "1e-7", want: "1e-7"},
+		{lit: "-1.5e-7", want: "-1.5e-7"},
+		{lit: "9007199254740993", want: "9007199254740992"},
+		{lit: "1.7976931348623157e308", want: "1.7976931348623157e+308"},
+		{lit: "5e-324", want: "5e-324"},
+		{lit: "0.1", want: "0.1"},
+		{lit: "123.456", want: "123.456"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.lit, func(t *testing.T) {
+			got, err := jp.CanonicalBytes(&jp.Number{Literal: tC.lit})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tC.want {
+				t.Fatalf("Bad number, got %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+	}{
+		{desc: "too big", data: "[1e400]"},
+		{desc: "duplicate keys", data: `{"a": 1, "b": 2, "a": 3}`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParser(strings.NewReader(tC.data))
+			v, err := p.Parse()
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			if _, err := jp.CanonicalBytes(v); !errors.Is(err, jp.ErrNotCanonicalizable) {
+				t.Fatalf("Wrong error, got %v, want %v", err, jp.ErrNotCanonicalizable)
+			}
+		})
+	}
+}
+
+func TestCanonicalDigest(t *testing.T) {
+	docs := []string{
+		`{"a": [1, 2.0, "x"], "b": {"c": true}}`,
+		"{\n  \"b\": {\"c\": true},\n  \"a\": [1.0, 2, \"\\u0078\"]\n}",
+		`{"b":{"c":true},"a":[10e-1,0.2e1,"x"]}`,
+	}
+
+	var first [32]byte
+	for i, doc := range docs {
+		p := jp.NewParser(strings.NewReader(doc))
+		v, err := p.Parse()
+		if err != nil {
+			t.Fatalf("Unexpected parse error: %v", err)
+		}
+		sum, err := jp.CanonicalDigest(v)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if i == 0 {
+			first = sum
+		} else if sum != first {
+			t.Fatalf("Digest of document %d differs: got %x, want %x", i, sum, first)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// DiffOptions controls how Diff decides what has changed.
+type DiffOptions struct {
+	// ArrayKey matches up the elements of arrays of objects by the value of
+	// this member rather than by position. Arrays where that doesn't give
+	// every element a distinct identity are matched by position.
+	ArrayKey string
+	// NumericEqual treats numbers as equal if they have the same value, so
+	// that 1 and 1.0 aren't reported as a change.
+	NumericEqual bool
+}
+
+type ChangeType string
+
+const (
+	Added   ChangeType = "add"
+	Removed ChangeType = "remove"
+	Changed ChangeType = "replace"
+	Moved   ChangeType = "move"
+)
+
+// Change is one difference between two documents. Old is set for removals
+// and changes, New for additions and changes and From for moves. Paths are
+// only meaningful once every change before them has been made, as they are
+// in a patch.
+type Change struct {
+	Type ChangeType
+	Path Pointer
+	From Pointer
+	Old  Value
+	New  Value
+}
+
+// Diff lists the changes that turn a into b.
+func Diff(a, b Value, opts DiffOptions) []Change {
+	d := differ{opts: opts}
+	d.value(Pointer{}, a, b)
+	return d.changes
+}
+
+// DiffPatch turns changes into an RFC 6902 patch.
+func DiffPatch(changes []Change) Patch {
+	patch := make(Patch, 0, len(changes))
+	for _, c := range changes {
+		op := Operation{Op: string(c.Type), Path: c.Path}
+		switch c.Type {
+		case Added, Changed:
+			op.Value = c.New
+		case Moved:
+			op.From = c.From
+		}
+		patch = append(patch, op)
+	}
+	return patch
+}
+
+// Value renders the patch in its JSON form.
+func (p Patch) Value() Value {
+	arr := &Array{Elems: make([]Value, 0, len(p))}
+	for _, op := range p {
+		obj := &Object{Members: []Member{
+			{Key: "op", Value: &String{Value: op.Op}},
+		}}
+		if op.Op == "move" || op.Op == "copy" {
+			obj.Set("from", &String{Value: op.From.String()})
+		}
+		obj.Set("path", &String{Value: op.Path.String()})
+		if op.Value != nil {
+			obj.Set("value", op.Value)
+		}
+		arr.Elems = append(arr.Elems, obj)
+	}
+	return arr
+}
+
+type differ struct {
+	opts    DiffOptions
+	changes []Change
+}
+
+func (d *differ) add(c Change) {
+	c.Path = slices.Clone(c.Path)
+	d.changes = append(d.changes, c)
+}
+
+func (d *differ) value(path Pointer, a, b Value) {
+	switch a := a.(type) {
+	case *Object:
+		if b, ok := b.(*Object); ok {
+			d.object(path, a, b)
+			return
+		}
+	case *Array:
+		if b, ok := b.(*Array); ok {
+			d.array(path, a, b)
+			return
+		}
+	}
+	if !d.sameScalar(a, b) {
+		d.add(Change{Type: Changed, Path: path, Old: a, New: b})
+	}
+}
+
+func (d *differ) sameScalar(a, b Value) bool {
+	switch a := a.(type) {
+	case *Number:
+		b, ok := b.(*Number)
+		if !ok {
+			return false
+		}
+		if d.opts.NumericEqual {
+			return compareNumbers(a, b) == 0
+		}
+		return a.Literal == b.Literal
+	case *Object, *Array:
+		return false
+	}
+	return Equal(a, b)
+}
+
+func (d *differ) object(path Pointer, a, b *Object) {
+	keys := uniqueKeys(a)
+	for _, k := range keys {
+		av, _ := a.Get(k)
+		bv, ok := b.Get(k)
+		if !ok {
+			d.add(Change{Type: Removed, Path: append(path, k), Old: av})
+			continue
+		}
+		d.value(append(path, k), av, bv)
+	}
+	for _, k := range uniqueKeys(b) {
+		if !slices.Contains(keys, k) {
+			bv, _ := b.Get(k)
+			d.add(Change{Type: Added, Path: append(path, k), New: bv})
+		}
+	}
+}
+
+func uniqueKeys(o *Object) []string {
+	keys := make([]string, 0, len(o.Members))
+	for _, m := range o.Members {
+		if !slices.Contains(keys, m.Key) {
+			keys = append(keys, m.Key)
+		}
+	}
+	return keys
+}
+
+// array compares elements position by position, then adds or removes
+// whatever is left over at the end. Removals run from the back so that each
+// index is still right when it is reached.
+func (d *differ) array(path Pointer, a, b *Array) {
+	if d.opts.ArrayKey != "" {
+		if ak, ok := d.identities(a); ok {
+			if bk, ok := d.identities(b); ok {
+				d.keyedArray(path, a, b, ak, bk)
+				return
+			}
+		}
+	}
+
+	common := min(len(a.Elems), len(b.Elems))
+	for i := range common {
+		d.value(append(path, strconv.Itoa(i)), a.Elems[i], b.Elems[i])
+	}
+	for i := len(a.Elems) - 1; i >= common; i-- {
+		d.add(Change{Type: Removed, Path: append(path, strconv.Itoa(i)), Old: a.Elems[i]})
+	}
+	for i := common; i < len(b.Elems); i++ {
+		d.add(Change{Type: Added, Path: append(path, strconv.Itoa(i)), New: b.Elems[i]})
+	}
+}
+
+// identities gives the identity of each element of arr, or fails if they
+// don't each have their own.
+func (d *differ) identities(arr *Array) ([]string, bool) {
+	ids := make([]string, 0, len(arr.Elems))
+	for _, e := range arr.Elems {
+		obj, ok := e.(*Object)
+		if !ok {
+			return nil, false
+		}
+		id, ok := obj.Get(d.opts.ArrayKey)
+		if !ok {
+			return nil, false
+		}
+		switch id.(type) {
+		case *Object, *Array:
+			return nil, false
+		}
+		key := FormatString(id, FormatOptions{})
+		if slices.Contains(ids, key) {
+			return nil, false
+		}
+		ids = append(ids, key)
+	}
+	return ids, true
+}
+
+// keyedArray first removes the elements that have gone, then walks through b
+// putting each element in place, either by moving it from further along or
+// adding it, and comparing the ones that were already there.
+func (d *differ) keyedArray(path Pointer, a, b *Array, aIDs, bIDs []string) {
+	cur := slices.Clone(aIDs)
+	elems := slices.Clone(a.Elems)
+	for i := len(cur) - 1; i >= 0; i-- {
+		if !slices.Contains(bIDs, cur[i]) {
+			d.add(Change{Type: Removed, Path: append(path, strconv.Itoa(i)), Old: elems[i]})
+			cur = slices.Delete(cur, i, i+1)
+			elems = slices.Delete(elems, i, i+1)
+		}
+	}
+
+	for j, id := range bIDs {
+		p := slices.Index(cur, id)
+		if p < 0 {
+			d.add(Change{Type: Added, Path: append(path, strconv.Itoa(j)), New: b.Elems[j]})
+			cur = slices.Insert(cur, j, id)
+			elems = slices.Insert(elems, j, b.Elems[j])
+			continue
+		}
+		if p != j {
+			d.add(Change{
+				Type: Moved,
+				Path: append(path, strconv.Itoa(j)),
+				From: append(slices.Clone(path), strconv.Itoa(p)),
+			})
+			v := elems[p]
+			cur = slices.Insert(slices.Delete(cur, p, p+1), j, id)
+			elems = slices.Insert(slices.Delete(elems, p, p+1), j, v)
+		}
+		d.value(append(path, strconv.Itoa(j)), elems[j], b.Elems[j])
+	}
+}
+
+// DiffTextOptions controls how WriteDiff lays out its report.
+type DiffTextOptions struct {
+	// Color highlights additions, removals, changes and moves with ANSI
+	// escape codes.
+	Color bool
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// WriteDiff writes a line for each change, saying where it happened and what
+// it was.
+func WriteDiff(w io.Writer, changes []Change, opts DiffTextOptions) error {
+	out := bufio.NewWriter(w)
+	for _, c := range changes {
+		var color, line string
+		switch c.Type {
+		case Added:
+			color = ansiGreen
+			line = fmt.Sprintf("+ %s: %s", describePath(c.Path), compact(c.New))
+		case Removed:
+			color = ansiRed
+			line = fmt.Sprintf("- %s: %s", describePath(c.Path), compact(c.Old))
+		case Changed:
+			color = ansiYellow
+			line = fmt.Sprintf("~ %s: %s -> %s", describePath(c.Path), compact(c.Old), compact(c.New))
+		case Moved:
+			color = ansiCyan
+			line = fmt.Sprintf("> %s: moved from %s", describePath(c.Path), describePath(c.From))
+		}
+		if opts.Color {
+			line = color + line + ansiReset
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+func describePath(p Pointer) string {
+	if len(p) == 0 {
+		return "(root)"
+	}
+	return p.String()
+}
+
+func compact(v Value) string {
+	return FormatString(v, FormatOptions{})
+}
@@ -0,0 +1,150 @@
+package main_test
+
+import (
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		desc string
+		a    string
+		b    string
+		opts jp.DiffOptions
+		want string
+	}{
+		{
+			desc: "identical",
+			a:    `{"a": [1, {"b": null}]}`,
+			b:    `{"a": [1, {"b": null}]}`,
+			want: ``,
+		},
+		{
+			desc: "scalar",
+			a:    `1`,
+			b:    `"1"`,
+			want: `~ (root): 1 -> "1"`,
+		},
+		{
+			desc: "members",
+			a:    `{"a": 1, "b": 2, "c": {"d": true}}`,
+			b:    `{"c": {"d": false}, "a": 1, "e": [3]}`,
+			want: "- /b: 2\n~ /c/d: true -> false\n+ /e: [3]",
+		},
+		{
+			desc: "type change",
+			a:    `{"a": [1]}`,
+			b:    `{"a": {"0": 1}}`,
+			want: `~ /a: [1] -> {"0":1}`,
+		},
+		{
+			desc: "array by index",
+			a:    `[1, 2, 3, 4]`,
+			b:    `[1, 5]`,
+			want: "~ /1: 2 -> 5\n- /3: 4\n- /2: 3",
+		},
+		{
+			desc: "array growth",
+			a:    `{"x": [1]}`,
+			b:    `{"x": [0, 1, 2]}`,
+			want: "~ /x/0: 1 -> 0\n+ /x/1: 1\n+ /x/2: 2",
+		},
+		{
+			desc: "numbers by literal",
+			a:    `[1, 2.50]`,
+			b:    `[1.0, 2.5]`,
+			want: "~ /0: 1 -> 1.0\n~ /1: 2.50 -> 2.5",
+		},
+		{
+			desc: "numbers by value",
+			a:    `[1, 2.50, 3]`,
+			b:    `[1.0, 2.5, 3e0, 4]`,
+			opts: jp.DiffOptions{NumericEqual: true},
+			want: `+ /3: 4`,
+		},
+		{
+			desc: "array by key",
+			a:    `[{"id": 1, "v": "a"}, {"id": 2, "v": "b"}, {"id": 3, "v": "c"}]`,
+			b:    `[{"id": 3, "v": "c"}, {"id": 4, "v": "d"}, {"id": 1, "v": "A"}]`,
+			opts: jp.DiffOptions{ArrayKey: "id"},
+			want: "- /1: {\"id\":2,\"v\":\"b\"}\n" +
+				"> /0: moved from /1\n" +
+				"+ /1: {\"id\":4,\"v\":\"d\"}\n" +
+				"~ /2/v: \"a\" -> \"A\"",
+		},
+		{
+			desc: "key missing falls back to index",
+			a:    `[{"id": 1}, {"v": 2}]`,
+			b:    `[{"v": 2}, {"id": 1}]`,
+			opts: jp.DiffOptions{ArrayKey: "id"},
+			want: "- /0/id: 1\n+ /0/v: 2\n- /1/v: 2\n+ /1/id: 1",
+		},
+		{
+			desc: "escaped paths",
+			a:    `{"a/b": {"~": 1}}`,
+			b:    `{"a/b": {"~": 2}}`,
+			want: `~ /a~1b/~0: 1 -> 2`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			a, b := parse(t, tC.a), parse(t, tC.b)
+			changes := jp.Diff(a, b, tC.opts)
+
+			var buf strings.Builder
+			if err := jp.WriteDiff(&buf, changes, jp.DiffTextOptions{}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := strings.TrimSuffix(buf.String(), "\n"); got != tC.want {
+				t.Fatalf("Bad diff: got\n%s\nwant\n%s", got, tC.want)
+			}
+
+			patched, err := jp.DiffPatch(changes).Apply(a)
+			if err != nil {
+				t.Fatalf("Unexpected error applying diff: %v", err)
+			}
+			if !jp.Equal(patched, b) {
+				t.Fatalf(
+					"Bad patch: got %s, want %s",
+					jp.FormatString(patched, jp.FormatOptions{}),
+					jp.FormatString(b, jp.FormatOptions{}),
+				)
+			}
+		})
+	}
+}
+
+func TestDiffPatchValue(t *testing.T) {
+	a := parse(t, `[{"id": "x", "n": 1}, {"id": "y"}]`)
+	b := parse(t, `[{"id": "y"}, {"id": "x"}]`)
+
+	patch := jp.DiffPatch(jp.Diff(a, b, jp.DiffOptions{ArrayKey: "id"}))
+	got := jp.FormatString(patch.Value(), jp.FormatOptions{})
+	want := `[{"op":"move","from":"/1","path":"/0"},{"op":"remove","path":"/1/n"}]`
+	if got != want {
+		t.Fatalf("Bad patch: got %s, want %s", got, want)
+	}
+
+	reparsed, err := jp.ParsePatch(parse(t, got))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := reparsed.Apply(a); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestWriteDiffColor(t *testing.T) {
+	changes := jp.Diff(parse(t, `{"a": 1}`), parse(t, `{"b": 1}`), jp.DiffOptions{})
+
+	var buf strings.Builder
+	if err := jp.WriteDiff(&buf, changes, jp.DiffTextOptions{Color: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "\x1b[31m- /a: 1\x1b[0m\n\x1b[32m+ /b: 1\x1b[0m\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("Bad diff: got %q, want %q", got, want)
+	}
+}
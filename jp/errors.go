@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnexpectedToken     = errors.New("unexpected token")
+	ErrUnexpectedEOF       = errors.New("unexpected end of input")
+	ErrTrailingData        = errors.New("additional top level token")
+	ErrMaxDepth            = errors.New("maximum nesting depth exceeded")
+	ErrUnrecognisedToken   = errors.New("unrecognised token")
+	ErrUnterminatedString  = errors.New("unterminated string")
+	ErrInvalidEscape       = errors.New("invalid escape sequence")
+	ErrInvalidUnicode      = errors.New("invalid unicode escape")
+	ErrControlChar         = errors.New("unescaped control character")
+	ErrInvalidUTF8         = errors.New("invalid UTF-8")
+	ErrLeadingZero         = errors.New("numbers cannot lead with zero")
+	ErrInvalidNumber       = errors.New("invalid number")
+	ErrUnterminatedComment = errors.New("unterminated comment")
+	ErrDuplicateKey        = errors.New("duplicate key")
+	ErrIJSON               = errors.New("not allowed in I-JSON")
+)
+
+// ParseError describes why a document was rejected. Cause is one of the
+// sentinel errors above, a *DuplicateKeyError, or the underlying error if the
+// input couldn't be read, so callers can branch on it with errors.Is.
+type ParseError struct {
+	Pos      Position
+	Found    Token
+	Expected []TokenType
+	Msg      string
+	Cause    error
+	Snippet  string
+}
+
+func (e *ParseError) Error() string {
+	var buf strings.Builder
+	var dup *DuplicateKeyError
+	if e.Found.Type == ILLEGAL {
+		buf.WriteString(e.Found.Literal)
+	} else if errors.As(e.Cause, &dup) {
+		fmt.Fprintf(&buf, "%s first defined at %s and again", dup, dup.First)
+	} else {
+		buf.WriteString(e.Msg)
+		if len(e.Expected) > 0 {
+			fmt.Fprintf(&buf, ", expected %s", describeTypes(e.Expected))
+		}
+		fmt.Fprintf(&buf, ", got %s", e.Found.describe())
+	}
+	fmt.Fprintf(&buf, " at %s", e.Pos)
+	if e.Snippet != "" {
+		fmt.Fprintf(&buf, "\n%s", e.Snippet)
+	}
+
+	return buf.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Cause
+}
+
+// DuplicateKeyError is the cause of a ParseError reporting an object member
+// named the same as an earlier one, the error's Pos being where the name was
+// repeated.
+type DuplicateKeyError struct {
+	Key   string
+	First Position
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %q", e.Key)
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return ErrDuplicateKey
+}
+
+// ErrorList holds every error found by a Parser running in recovery mode, in
+// the order they occur in the input.
+type ErrorList []*ParseError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, 0, len(l))
+	for _, err := range l {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// lexError records where in the input the lexer gave up and which sentinel
+// the failure corresponds to.
+type lexError struct {
+	pos   Position
+	msg   string
+	cause error
+}
+
+func (e *lexError) Error() string {
+	return e.msg
+}
+
+func (e *lexError) Unwrap() error {
+	return e.cause
+}
+
+func describeTypes(tts []TokenType) string {
+	names := make([]string, 0, len(tts))
+	for _, tt := range tts {
+		names = append(names, describeType(tt))
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+
+	last := len(names) - 1
+	return strings.Join(names[:last], ", ") + " or " + names[last]
+}
+
+func describeType(tt TokenType) string {
+	switch tt {
+	case EOF:
+		return "end of input"
+	case RS:
+		return "record separator"
+	case LBRACE, RBRACE, LPAREN, RPAREN, LBRCKT, RBRCKT, COLON, COMMA:
+		return fmt.Sprintf("'%s'", tt)
+	}
+	return string(tt)
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type EventType string
+
+const (
+	StartObject EventType = "StartObject"
+	StartArray  EventType = "StartArray"
+	Key         EventType = "Key"
+	Scalar      EventType = "Scalar"
+	End         EventType = "End"
+)
+
+// Event is a single step through a document. Token is what the event was read
+// from: the opening or closing bracket, the member name or the scalar value.
+// Path locates the value the event belongs to; for a Key it is the member
+// about to be read and for End it is the container being closed.
+//
+// Path is reused from one event to the next, copy it if it needs to outlive
+// the following call to Next.
+type Event struct {
+	Type  EventType
+	Token Token
+	Path  Path
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s %s %s", e.Path, e.Type, e.Token.describe())
+}
+
+// PathElem is one step into a document, either the name of an object member
+// or, when Index isn't negative, the position of an array element.
+type PathElem struct {
+	Key   string
+	Index int
+}
+
+func KeyElem(key string) PathElem {
+	return PathElem{Key: key, Index: -1}
+}
+
+func IndexElem(i int) PathElem {
+	return PathElem{Index: i}
+}
+
+func (e PathElem) IsIndex() bool {
+	return e.Index >= 0
+}
+
+func (e PathElem) String() string {
+	if e.IsIndex() {
+		return strconv.Itoa(e.Index)
+	}
+	return e.Key
+}
+
+// Path locates a value within a document, it renders as a JSON Pointer.
+type Path []PathElem
+
+func (p Path) String() string {
+	var buf strings.Builder
+	for _, e := range p {
+		buf.WriteByte('/')
+		buf.WriteString(pointerEscaper.Replace(e.String()))
+	}
+	return buf.String()
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// level is an open container. The reader only remembers where it is in each
+// one, not what it holds, so memory use depends on how deeply the document
+// nests rather than on its size.
+type level struct {
+	obj  bool
+	next int
+
+	// keys remembers where each member name was first used, when looking for
+	// duplicates.
+	keys map[string]Position
+}
+
+func (lv level) closer() TokenType {
+	if lv.obj {
+		return RBRACE
+	}
+	return RBRCKT
+}
+
+func (lv level) stops() []TokenType {
+	return []TokenType{COMMA, lv.closer()}
+}
+
+type parseState int
+
+const (
+	expectValue parseState = iota
+	expectKey
+	expectNext
+	expectEnd
+	finished
+)
+
+// EventReader checks the grammar of a document as it streams through it,
+// handing back one Event at a time.
+type EventReader struct {
+	lx     Lexer
+	tok    Token
+	opts   Options
+	errs   ErrorList
+	warns  ErrorList
+	err    error
+	levels []level
+	path   Path
+	state  parseState
+}
+
+func NewEventReader(src io.Reader, opts Options) EventReader {
+	r := EventReader{
+		lx:   newLexer(src, opts),
+		opts: opts,
+	}
+	r.opts.Duplicates = opts.duplicates()
+	if opts.Sequence {
+		r.state = expectEnd
+	}
+
+	r.readToken()
+
+	return r
+}
+
+// Walk feeds each event in the document to fn, stopping at the first error
+// either of them returns. In recovery mode any problems found in the document
+// are returned as an ErrorList once the whole of it has been read.
+func Walk(src io.Reader, opts Options, fn func(Event) error) error {
+	r := NewEventReader(src, opts)
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+
+	if len(r.errs) > 0 {
+		return r.errs
+	}
+	return nil
+}
+
+// Next returns the next event in the document, or io.EOF once it has all been
+// read. In recovery mode problems are collected for Errors rather than
+// returned.
+func (r *EventReader) Next() (Event, error) {
+	for r.err == nil {
+		if ev, ok := r.step(); ok {
+			return ev, nil
+		}
+	}
+	return Event{}, r.err
+}
+
+// Errors returns the problems found so far in recovery mode.
+func (r *EventReader) Errors() ErrorList {
+	return r.errs
+}
+
+// Warnings returns the problems found so far that didn't stop the document
+// being read.
+func (r *EventReader) Warnings() ErrorList {
+	return r.warns
+}
+
+// Depth is the number of containers currently open.
+func (r *EventReader) Depth() int {
+	return len(r.levels)
+}
+
+func (r *EventReader) readToken() {
+	r.tok = r.lx.NextToken()
+	if r.opts.Debug {
+		fmt.Println(r.tok.String())
+	}
+}
+
+// step moves the reader on by one transition of the grammar, reporting
+// whether that produced an event.
+func (r *EventReader) step() (Event, bool) {
+	switch r.state {
+	case expectValue:
+		return r.readValue()
+	case expectKey:
+		return r.readKey()
+	case expectNext:
+		return r.readNext()
+	case expectEnd:
+		r.readEnd()
+	case finished:
+		r.err = io.EOF
+	}
+	return Event{}, false
+}
+
+func (r *EventReader) readValue() (Event, bool) {
+	var ev Event
+	switch r.tok.Type {
+	case LBRACE, LBRCKT:
+		if limit := r.maxDepth(); limit > 0 && len(r.levels) >= limit {
+			err := r.fail(fmt.Sprintf("maximum nesting depth of %d exceeded", limit))
+			err.Cause = ErrMaxDepth
+			r.skipValue(err)
+			return Event{}, false
+		}
+		ev = r.event(StartArray)
+		if r.tok.Type == LBRACE {
+			ev.Type = StartObject
+		}
+		lv := level{obj: ev.Type == StartObject}
+		if lv.obj && (r.opts.Duplicates == WarnDuplicates || r.opts.Duplicates == RejectDuplicates) {
+			lv.keys = map[string]Position{}
+		}
+		r.levels = append(r.levels, lv)
+		r.path = append(r.path, PathElem{})
+		r.readToken()
+		r.state = expectValue
+		switch {
+		case r.tok.Type == r.top().closer():
+			r.state = expectNext
+		case ev.Type == StartObject:
+			r.state = expectKey
+		}
+		return ev, true
+	case NULL, STRING, NUM, TRUE, FALSE:
+		if r.tok.Type == NUM && r.opts.IJSON {
+			r.checkNumber()
+			if r.err != nil {
+				return Event{}, false
+			}
+		}
+		ev = r.event(Scalar)
+		r.readToken()
+		r.afterValue()
+		return ev, true
+	default:
+		r.skipValue(r.fail("invalid expression", valueStart...))
+		return Event{}, false
+	}
+}
+
+func (r *EventReader) readKey() (Event, bool) {
+	r.state = expectNext
+	key := r.tok
+	switch {
+	case key.Type == STRING:
+	case r.opts.Relaxed && r.isIdentifier(key):
+		key.Value = key.Literal
+	default:
+		r.resync(r.fail("malformed object key", STRING), COMMA, RBRACE)
+		return Event{}, false
+	}
+	if r.checkDuplicate(key); r.err != nil {
+		return Event{}, false
+	}
+	r.readToken()
+	if r.tok.Type != COLON {
+		r.resync(r.fail("malformed object member", COLON), COMMA, RBRACE)
+		return Event{}, false
+	}
+	r.readToken()
+
+	r.path[len(r.path)-1] = KeyElem(key.Value)
+	r.state = expectValue
+
+	return Event{Type: Key, Token: key, Path: r.path}, true
+}
+
+func (r *EventReader) readNext() (Event, bool) {
+	top := r.top()
+	switch r.tok.Type {
+	case COMMA:
+		r.readToken()
+		r.state = expectValue
+		if top.obj {
+			r.state = expectKey
+		}
+		if r.opts.Relaxed && r.tok.Type == top.closer() {
+			r.state = expectNext
+		}
+		return Event{}, false
+	case top.closer():
+		tok := r.tok
+		r.readToken()
+		return r.close(tok), true
+	}
+
+	msg := "malformed array"
+	if top.obj {
+		msg = "malformed object"
+	}
+	r.resync(r.fail(msg, top.stops()...), top.stops()...)
+
+	// Only a resync in recovery mode can leave us at the end of input, or of
+	// a record in a sequence, in which case close whatever is still open.
+	if r.err == nil && isBreak(r.tok) {
+		return r.close(r.tok), true
+	}
+	return Event{}, false
+}
+
+func (r *EventReader) readEnd() {
+	switch {
+	case r.tok.Type == EOF:
+		r.state = finished
+		return
+	case r.opts.Sequence && r.tok.Type == RS:
+		r.readToken()
+		return
+	case r.opts.Sequence:
+		r.state = expectValue
+		return
+	}
+
+	err := r.fail("additional top level token", EOF)
+	if r.tok.Type != ILLEGAL {
+		err.Cause = ErrTrailingData
+	}
+	r.resync(err)
+	r.state = finished
+}
+
+// event builds an event for the current token, which starts a value.
+func (r *EventReader) event(et EventType) Event {
+	if n := len(r.levels); n > 0 && !r.levels[n-1].obj {
+		r.path[n-1] = IndexElem(r.levels[n-1].next)
+		r.levels[n-1].next++
+	}
+	return Event{Type: et, Token: r.tok, Path: r.path}
+}
+
+func (r *EventReader) close(tok Token) Event {
+	r.levels = r.levels[:len(r.levels)-1]
+	r.path = r.path[:len(r.path)-1]
+	r.afterValue()
+
+	return Event{Type: End, Token: tok, Path: r.path}
+}
+
+func (r *EventReader) afterValue() {
+	r.state = expectNext
+	if len(r.levels) == 0 {
+		r.state = expectEnd
+	}
+}
+
+// skipValue abandons a value that couldn't be read. In a sequence anything
+// up to the start of the next value is skipped.
+func (r *EventReader) skipValue(err *ParseError) {
+	if len(r.levels) == 0 && r.opts.Sequence {
+		r.resync(err, valueStart...)
+		r.state = expectEnd
+		return
+	}
+	if len(r.levels) == 0 {
+		r.resync(err)
+		r.state = finished
+		return
+	}
+	r.resync(err, r.top().stops()...)
+	r.state = expectNext
+}
+
+// checkDuplicate reports key if the object has already used its name. This is
+// done before moving past the key so the error can show the line it is on.
+func (r *EventReader) checkDuplicate(key Token) {
+	keys := r.top().keys
+	if keys == nil {
+		return
+	}
+	first, ok := keys[key.Value]
+	if !ok {
+		keys[key.Value] = key.Start
+		return
+	}
+
+	err := &ParseError{
+		Pos:     key.Start,
+		Found:   key,
+		Msg:     "duplicate key",
+		Cause:   &DuplicateKeyError{Key: key.Value, First: first},
+		Snippet: r.lx.snippet(key.Start),
+	}
+	if r.opts.Duplicates == WarnDuplicates {
+		r.warns = append(r.warns, err)
+		return
+	}
+	r.reject(err)
+}
+
+// maxIJSONInt is the largest integer I-JSON allows, 2^53-1.
+const maxIJSONInt = 1<<53 - 1
+
+// checkNumber rejects the current number if it isn't allowed in I-JSON,
+// either because a double can't hold it or it is an integer too large to be
+// held exactly by everyone. Integers are checked against that range before
+// precision, as losing precision is only a symptom of being outside it.
+func (r *EventReader) checkNumber() {
+	n := &Number{Literal: r.tok.Literal}
+	if r.tok.Value != "" {
+		n.Literal = r.tok.Value
+	}
+
+	var msg string
+	_, ferr := n.Float64()
+	i, ierr := n.Int64()
+	switch {
+	case errors.Is(ferr, ErrNumberRange):
+		msg = "number is too large for a double"
+	case errors.Is(ierr, ErrNumberRange), ierr == nil && (i > maxIJSONInt || i < -maxIJSONInt):
+		msg = "integer is outside the range ±(2^53-1)"
+	case ferr != nil:
+		msg = "number is more precise than a double"
+	default:
+		return
+	}
+
+	r.reject(&ParseError{
+		Pos:     r.tok.Start,
+		Found:   r.tok,
+		Msg:     msg,
+		Cause:   ErrIJSON,
+		Snippet: r.lx.snippet(r.tok.Start),
+	})
+}
+
+// reject deals with a document that is well formed but not acceptable, which
+// unlike a syntax error doesn't mean any of it needs to be skipped.
+func (r *EventReader) reject(err *ParseError) {
+	if r.opts.Recover {
+		r.errs = append(r.errs, err)
+		return
+	}
+	r.err = err
+}
+
+// isIdentifier reports whether tok can name an object member in JSON5, which
+// allows reserved words such as true and Infinity as well as plain names.
+func (r *EventReader) isIdentifier(tok Token) bool {
+	switch tok.Type {
+	case IDENT, NULL, TRUE, FALSE:
+		return true
+	case NUM:
+		return tok.Literal == "Infinity" || tok.Literal == "NaN"
+	}
+	return false
+}
+
+func (r *EventReader) top() level {
+	return r.levels[len(r.levels)-1]
+}
+
+func (r *EventReader) maxDepth() int {
+	if r.opts.MaxDepth == 0 {
+		return DefaultMaxDepth
+	}
+	return r.opts.MaxDepth
+}
+
+var valueStart = []TokenType{LBRACE, LBRCKT, STRING, NUM, TRUE, FALSE, NULL}
+
+// fail reports that the current token doesn't fit the grammar at this point,
+// pointing at where in the input it occurred.
+func (r *EventReader) fail(msg string, expected ...TokenType) *ParseError {
+	pos := r.tok.Start
+	var cause error = ErrUnexpectedToken
+	switch r.tok.Type {
+	case ILLEGAL:
+		pos = r.tok.End
+		cause = r.tok.Err
+	case EOF:
+		cause = ErrUnexpectedEOF
+	}
+
+	return &ParseError{
+		Pos:      pos,
+		Found:    r.tok,
+		Expected: expected,
+		Msg:      msg,
+		Cause:    cause,
+		Snippet:  r.lx.snippet(pos),
+	}
+}
+
+// resync deals with err. Outside of recovery mode that means stopping,
+// otherwise err is recorded and the reader skips ahead to the next of the stop
+// tokens at the current nesting level, or the end of input.
+func (r *EventReader) resync(err *ParseError, stop ...TokenType) {
+	if !r.opts.Recover {
+		r.err = err
+		return
+	}
+
+	// Once the input, or a record, has run out every open container will
+	// complain about it, which tells the user nothing new.
+	last := len(r.errs) - 1
+	if !isBreak(err.Found) || last < 0 || r.errs[last].Found.Start != err.Found.Start {
+		r.errs = append(r.errs, err)
+	}
+
+	depth := 0
+	for !isBreak(r.tok) {
+		if depth == 0 && slices.Contains(stop, r.tok.Type) {
+			break
+		}
+		switch r.tok.Type {
+		case LBRACE, LBRCKT:
+			depth++
+		case RBRACE, RBRCKT:
+			depth = max(depth-1, 0)
+		}
+		r.readToken()
+	}
+}
+
+// isBreak reports whether tok ends the input or a record in a sequence, which
+// no error recovery can skip past.
+func isBreak(tok Token) bool {
+	return tok.Type == EOF || tok.Type == RS
+}
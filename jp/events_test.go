@@ -0,0 +1,176 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestEvents(t *testing.T) {
+	data := `{"a": [1, {"b/c": null}], "d~": "e", "f": {}}`
+	want := []string{
+		" StartObject '{'",
+		"/a Key STRING(\"a\")",
+		"/a StartArray '['",
+		"/a/0 Scalar NUM(1)",
+		"/a/1 StartObject '{'",
+		"/a/1/b~1c Key STRING(\"b/c\")",
+		"/a/1/b~1c Scalar NULL(null)",
+		"/a/1 End '}'",
+		"/a End ']'",
+		"/d~0 Key STRING(\"d~\")",
+		"/d~0 Scalar STRING(\"e\")",
+		"/f Key STRING(\"f\")",
+		"/f StartObject '{'",
+		"/f End '}'",
+		" End '}'",
+	}
+
+	r := jp.NewEventReader(strings.NewReader(data), jp.Options{})
+	got := []string{}
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got = append(got, ev.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bad events:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestEventErrors(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		data   string
+		events int
+		err    error
+	}{
+		{desc: "scalar", data: "true", events: 1},
+		{desc: "bad value", data: "[1, 2, x]", events: 3, err: jp.ErrUnexpectedToken},
+		{desc: "missing colon", data: `{"a" 1}`, events: 1, err: jp.ErrUnexpectedToken},
+		{desc: "truncated", data: `[[1]`, events: 4, err: jp.ErrUnexpectedEOF},
+		{desc: "trailing", data: `[] 1`, events: 2, err: jp.ErrTrailingData},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			events := 0
+			err := jp.Walk(strings.NewReader(tC.data), jp.Options{}, func(jp.Event) error {
+				events++
+				return nil
+			})
+			if !errors.Is(err, tC.err) || (tC.err == nil && err != nil) {
+				t.Fatalf("Wrong error, got %v, want %v", err, tC.err)
+			}
+			if events != tC.events {
+				t.Fatalf("Wrong number of events, got %d, want %d", events, tC.events)
+			}
+		})
+	}
+}
+
+func TestWalkStopsOnHandlerError(t *testing.T) {
+	stop := errors.New("stop")
+	events := 0
+	err := jp.Walk(strings.NewReader("[1, 2, 3]"), jp.Options{}, func(ev jp.Event) error {
+		events++
+		if ev.Type == jp.Scalar && ev.Token.Literal == "2" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("Wrong error, got %v, want %v", err, stop)
+	}
+	if events != 3 {
+		t.Fatalf("Wrong number of events, got %d, want 3", events)
+	}
+}
+
+func TestEventsRecover(t *testing.T) {
+	data := `[1, x, {"a" 2, "b": 3}, 4`
+	want := []string{
+		" StartArray '['",
+		"/0 Scalar NUM(1)",
+		"/1 StartObject '{'",
+		"/1/b Key STRING(\"b\")",
+		"/1/b Scalar NUM(3)",
+		"/1 End '}'",
+		"/2 Scalar NUM(4)",
+		" End end of input",
+	}
+
+	got := []string{}
+	err := jp.Walk(strings.NewReader(data), jp.Options{Recover: true}, func(ev jp.Event) error {
+		got = append(got, ev.String())
+		return nil
+	})
+	var errs jp.ErrorList
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("Wrong errors: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bad events:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+// bigArray generates a large array without ever holding it in memory.
+type bigArray struct {
+	n, size int
+	pending []byte
+}
+
+func (b *bigArray) Read(p []byte) (int, error) {
+	for len(b.pending) < len(p) && b.n <= b.size {
+		switch {
+		case b.n == 0:
+			b.pending = append(b.pending, '[')
+		case b.n == b.size:
+			b.pending = append(b.pending, `{"k": 1}]`...)
+		default:
+			b.pending = fmt.Appendf(b.pending, `{"k": %d},`, b.n)
+		}
+		b.n++
+	}
+	if len(b.pending) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func TestEventsStreamLargeInput(t *testing.T) {
+	const size = 100_000
+	scalars := 0
+	maxDepth := 0
+	r := jp.NewEventReader(&bigArray{size: size}, jp.Options{})
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ev.Type == jp.Scalar {
+			scalars++
+		}
+		maxDepth = max(maxDepth, r.Depth())
+	}
+	if scalars != size {
+		t.Fatalf("Wrong number of scalars, got %d, want %d", scalars, size)
+	}
+	if maxDepth != 2 {
+		t.Fatalf("Wrong depth, got %d, want 2", maxDepth)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// field is a struct field that maps to an object member, as described by its
+// json tag, e.g. `json:"name,omitempty,string"`.
+type field struct {
+	name      string
+	index     []int
+	typ       reflect.Type
+	tagged    bool
+	omitEmpty bool
+	// quoted fields hold their value as a JSON string, e.g. "42" for an int.
+	quoted bool
+}
+
+var fieldCache sync.Map
+
+// structFields lists the fields of struct type t that map to object members,
+// in the order they are declared.
+func structFields(t reflect.Type) []field {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]field)
+	}
+	fields, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return fields.([]field)
+}
+
+// typeFields finds the fields of t, including those promoted from embedded
+// structs without a name of their own. As in Go, a field hides any of the same
+// name nested more deeply and two at the same depth hide each other, unless
+// only one of them is named by its tag.
+func typeFields(t reflect.Type) []field {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var fields []field
+	decided := map[string]bool{}
+	visited := map[reflect.Type]bool{}
+	for next := []embedded{{typ: t}}; len(next) > 0; {
+		current := next
+		next = nil
+
+		var found []field
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			for i := range e.typ.NumField() {
+				sf := e.typ.Field(i)
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				index := append(slices.Clone(e.index), i)
+
+				ft := sf.Type
+				if sf.Anonymous {
+					if ft.Kind() == reflect.Pointer {
+						ft = ft.Elem()
+					}
+					if name == "" && ft.Kind() == reflect.Struct {
+						next = append(next, embedded{ft, index})
+						continue
+					}
+				}
+				if !sf.IsExported() {
+					continue
+				}
+
+				f := field{name: name, index: index, typ: sf.Type, tagged: name != ""}
+				if name == "" {
+					f.name = sf.Name
+				}
+				for opt := range strings.SplitSeq(opts, ",") {
+					switch opt {
+					case "omitempty":
+						f.omitEmpty = true
+					case "string":
+						f.quoted = canQuote(ft)
+					}
+				}
+				found = append(found, f)
+			}
+		}
+		for _, e := range current {
+			visited[e.typ] = true
+		}
+
+		for _, f := range found {
+			if decided[f.name] {
+				continue
+			}
+			decided[f.name] = true
+			if f, ok := dominantField(found, f.name); ok {
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	slices.SortFunc(fields, func(a, b field) int {
+		return slices.Compare(a.index, b.index)
+	})
+	return fields
+}
+
+// dominantField picks the field called name from those found at one depth, if
+// there is one that isn't ambiguous.
+func dominantField(found []field, name string) (field, bool) {
+	var candidates []field
+	for _, f := range found {
+		if f.name == name {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+
+	var tagged []field
+	for _, f := range candidates {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return field{}, false
+}
+
+// canQuote reports whether the string tag option applies to values of type t,
+// which it only does for scalars.
+func canQuote(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// lookupField finds the field a member named key belongs in, preferring an
+// exact match but falling back to one that differs only in case.
+func lookupField(fields []field, key string) (field, bool) {
+	i := slices.IndexFunc(fields, func(f field) bool { return f.name == key })
+	if i < 0 {
+		i = slices.IndexFunc(fields, func(f field) bool { return strings.EqualFold(f.name, key) })
+	}
+	if i < 0 {
+		return field{}, false
+	}
+	return fields[i], true
+}
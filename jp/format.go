@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// FormatOptions controls the layout Format uses. The zero value writes
+// documents on a single line with no insignificant whitespace.
+type FormatOptions struct {
+	// Indent is one level of indentation. An empty indent gives compact
+	// output.
+	Indent string
+	// SortKeys writes object members in key order rather than source order.
+	SortKeys bool
+	// ArrayWidth keeps arrays that hold only scalars on a single line as long
+	// as that line is no wider than this. Zero always breaks arrays up.
+	ArrayWidth int
+	// EscapeHTML escapes <, > and & in strings, along with U+2028 and U+2029,
+	// so the output can be embedded in HTML and JavaScript.
+	EscapeHTML bool
+	// ASCII escapes every character outside ASCII in strings.
+	ASCII bool
+}
+
+// ErrNonFinite is returned by Format for the numbers JSON5 can spell but JSON
+// can't: Infinity, -Infinity and NaN.
+var ErrNonFinite = errors.New("number has no JSON representation")
+
+// Format writes v to w laid out as described by opts. Nothing is written if v
+// holds a number that can't be written as JSON.
+func Format(w io.Writer, v Value, opts FormatOptions) error {
+	if err := checkFinite(v, Pointer{}); err != nil {
+		return err
+	}
+	f := formatter{w: bufio.NewWriter(w), opts: opts}
+	f.value(v, 0)
+	return f.w.Flush()
+}
+
+// FormatString is a convenience wrapper around Format for building strings,
+// such as those describing values in messages. Unlike Format it writes
+// non-finite numbers as they are named, so the result isn't always JSON.
+func FormatString(v Value, opts FormatOptions) string {
+	var buf strings.Builder
+	f := formatter{w: bufio.NewWriter(&buf), opts: opts}
+	f.value(v, 0)
+	f.w.Flush()
+	return buf.String()
+}
+
+// checkFinite finds the first number in v that JSON can't represent.
+func checkFinite(v Value, path Pointer) error {
+	switch v := v.(type) {
+	case *Number:
+		if !v.finite() {
+			return fmt.Errorf("%w: %s at %s", ErrNonFinite, v.Literal, describePath(path))
+		}
+	case *Array:
+		for i, e := range v.Elems {
+			if err := checkFinite(e, append(path, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+	case *Object:
+		for _, m := range v.Members {
+			if err := checkFinite(m.Value, append(path, m.Key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type formatter struct {
+	w    *bufio.Writer
+	opts FormatOptions
+}
+
+func (f *formatter) value(v Value, depth int) {
+	switch v := v.(type) {
+	case *Object:
+		f.object(v, depth)
+	case *Array:
+		f.array(v, depth)
+	default:
+		f.scalar(v)
+	}
+}
+
+func (f *formatter) scalar(v Value) {
+	f.w.Write(appendScalar(nil, v, f.opts))
+}
+
+func appendScalar(buf []byte, v Value, opts FormatOptions) []byte {
+	switch v := v.(type) {
+	case *String:
+		return appendQuoted(buf, v.Value, opts)
+	case *Number:
+		return append(buf, v.Literal...)
+	case *Bool:
+		return strconv.AppendBool(buf, v.Value)
+	}
+	return append(buf, "null"...)
+}
+
+func (f *formatter) object(o *Object, depth int) {
+	if len(o.Members) == 0 {
+		f.w.WriteString("{}")
+		return
+	}
+
+	members := o.Members
+	if f.opts.SortKeys {
+		members = slices.Clone(members)
+		slices.SortStableFunc(members, func(a, b Member) int {
+			return cmp.Compare(a.Key, b.Key)
+		})
+	}
+
+	f.w.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			f.w.WriteByte(',')
+		}
+		f.newline(depth + 1)
+		f.w.Write(appendQuoted(nil, m.Key, f.opts))
+		f.w.WriteByte(':')
+		if f.opts.Indent != "" {
+			f.w.WriteByte(' ')
+		}
+		f.value(m.Value, depth+1)
+	}
+	f.newline(depth)
+	f.w.WriteByte('}')
+}
+
+func (f *formatter) array(a *Array, depth int) {
+	if len(a.Elems) == 0 {
+		f.w.WriteString("[]")
+		return
+	}
+	if line, ok := f.inlineArray(a); ok {
+		f.w.WriteString(line)
+		return
+	}
+
+	f.w.WriteByte('[')
+	for i, v := range a.Elems {
+		if i > 0 {
+			f.w.WriteByte(',')
+		}
+		f.newline(depth + 1)
+		f.value(v, depth+1)
+	}
+	f.newline(depth)
+	f.w.WriteByte(']')
+}
+
+// inlineArray renders a on one line if it should be kept that way.
+func (f *formatter) inlineArray(a *Array) (string, bool) {
+	if f.opts.Indent == "" || f.opts.ArrayWidth <= 0 {
+		return "", false
+	}
+
+	line := []byte{'['}
+	for i, v := range a.Elems {
+		switch v.(type) {
+		case *Object, *Array:
+			return "", false
+		}
+		if i > 0 {
+			line = append(line, ", "...)
+		}
+		line = appendScalar(line, v, f.opts)
+		if len(line) > 4*f.opts.ArrayWidth {
+			return "", false
+		}
+	}
+	line = append(line, ']')
+
+	return string(line), utf8.RuneCount(line) <= f.opts.ArrayWidth
+}
+
+func (f *formatter) newline(depth int) {
+	if f.opts.Indent == "" {
+		return
+	}
+	f.w.WriteByte('\n')
+	for range depth {
+		f.w.WriteString(f.opts.Indent)
+	}
+}
+
+const hex = "0123456789abcdef"
+
+// appendString appends s to buf as a quoted JSON string, escaping only what
+// has to be escaped.
+func appendString(buf []byte, s string) []byte {
+	return appendQuoted(buf, s, FormatOptions{})
+}
+
+// appendQuoted appends s to buf as a quoted JSON string, escaping what has to
+// be escaped and whatever else opts asks for.
+func appendQuoted(buf []byte, s string, opts FormatOptions) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' && !(opts.EscapeHTML && (c == '<' || c == '>' || c == '&')) {
+			if c < utf8.RuneSelf {
+				buf = append(buf, c)
+				i++
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			switch {
+			case opts.ASCII && r > 0xffff:
+				r1, r2 := utf16.EncodeRune(r)
+				buf = appendEscapedRune(buf, r1)
+				buf = appendEscapedRune(buf, r2)
+			case opts.ASCII, opts.EscapeHTML && (r == '\u2028' || r == '\u2029'):
+				buf = appendEscapedRune(buf, r)
+			default:
+				buf = utf8.AppendRune(buf, r)
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\\':
+			buf = append(buf, '\\', c)
+		case '\b':
+			buf = append(buf, '\\', 'b')
+		case '\f':
+			buf = append(buf, '\\', 'f')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		default:
+			buf = appendEscapedRune(buf, rune(c))
+		}
+		i++
+	}
+
+	return append(buf, '"')
+}
+
+func appendEscapedRune(buf []byte, r rune) []byte {
+	return append(buf, '\\', 'u', hex[r>>12&0xf], hex[r>>8&0xf], hex[r>>4&0xf], hex[r&0xf])
+}
@@ -0,0 +1,126 @@
+package main_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestFormat(t *testing.T) {
+	doc := `{"b": [1, 2, 3], "a": {"z": null, "y": [true, {"k": "v"}]}, "c": [], "d": {}}`
+	testCases := []struct {
+		desc string
+		opts jp.FormatOptions
+		want string
+	}{
+		{
+			desc: "compact",
+			opts: jp.FormatOptions{},
+			want: `{"b":[1,2,3],"a":{"z":null,"y":[true,{"k":"v"}]},"c":[],"d":{}}`,
+		},
+		{
+			desc: "two spaces",
+			opts: jp.FormatOptions{Indent: "  "},
+			want: `{
+  "b": [
+    1,
+    2,
+    3
+  ],
+  "a": {
+    "z": null,
+    "y": [
+      true,
+      {
+        "k": "v"
+      }
+    ]
+  },
+  "c": [],
+  "d": {}
+}`,
+		},
+		{
+			desc: "tabs sorted with short arrays",
+			opts: jp.FormatOptions{Indent: "\t", SortKeys: true, ArrayWidth: 10},
+			want: "{\n\t\"a\": {\n\t\t\"y\": [\n\t\t\ttrue,\n\t\t\t{\n\t\t\t\t\"k\": \"v\"\n\t\t\t}\n\t\t],\n" +
+				"\t\t\"z\": null\n\t},\n\t\"b\": [1, 2, 3],\n\t\"c\": [],\n\t\"d\": {}\n}",
+		},
+		{
+			desc: "array too wide to inline",
+			opts: jp.FormatOptions{Indent: " ", ArrayWidth: 8},
+			want: "{\n \"b\": [\n  1,\n  2,\n  3\n ],\n \"a\": {\n  \"z\": null,\n  \"y\": [\n   true,\n" +
+				"   {\n    \"k\": \"v\"\n   }\n  ]\n },\n \"c\": [],\n \"d\": {}\n}",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParser(strings.NewReader(doc))
+			v, err := p.Parse()
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			if got := jp.FormatString(v, tC.opts); got != tC.want {
+				t.Fatalf("Bad format, got\n%s\nwant\n%s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestFormatScalars(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		want string
+	}{
+		{desc: "number literal kept", data: "1.50E+03", want: "1.50E+03"},
+		{desc: "escapes", data: `"q\" b\\ \/ \b\f\n\r\t \u0001"`, want: `"q\" b\\ / \b\f\n\r\t \u0001"`},
+		{desc: "unicode", data: `"é 日本 😀"`, want: `"é 日本 😀"`},
+		{desc: "keys escaped", data: `{"a\"b": true}`, want: `{"a\"b":true}`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParser(strings.NewReader(tC.data))
+			v, err := p.Parse()
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			if got := jp.FormatString(v, jp.FormatOptions{}); got != tC.want {
+				t.Fatalf("Bad format, got %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestFormatNonFinite(t *testing.T) {
+	testCases := []struct {
+		data string
+		err  string
+	}{
+		{data: `NaN`, err: "number has no JSON representation: NaN at (root)"},
+		{data: `{a: [1, Infinity]}`, err: "number has no JSON representation: Infinity at /a/1"},
+		{data: `[{b: -Infinity}]`, err: "number has no JSON representation: -Infinity at /0/b"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.data, func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(tC.data), jp.Options{Relaxed: true})
+			v, err := p.Parse()
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			var out strings.Builder
+			err = jp.Format(&out, v, jp.FormatOptions{Indent: "  "})
+			if !errors.Is(err, jp.ErrNonFinite) || err.Error() != tC.err {
+				t.Fatalf("Bad error: got %v, want %s", err, tC.err)
+			}
+			if out.Len() > 0 {
+				t.Fatalf("Wrote output: %s", out.String())
+			}
+			if _, err := jp.Marshal(v); !errors.Is(err, jp.ErrNonFinite) {
+				t.Fatalf("Bad marshal error: got %v, want %v", err, jp.ErrNonFinite)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"cmp"
+	"math/big"
+	"net/mail"
+	"regexp"
+	"slices"
+	"time"
+)
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// InferOptions tunes InferSchema.
+type InferOptions struct {
+	// MaxEnum is the most distinct values a string may take across the
+	// samples and still be described with an enum. Zero turns enums off.
+	MaxEnum int
+}
+
+// InferSchema builds a JSON Schema that every one of the samples matches.
+// Properties are required if they appear in every object seen at that point,
+// values of differing types become a union, and strings are described by a
+// format or an enum where the samples suggest one.
+func InferSchema(samples []Value, opts InferOptions) Value {
+	root := newShape()
+	for _, s := range samples {
+		root.add(s, opts)
+	}
+
+	schema := &Object{Members: []Member{{Key: "$schema", Value: &String{Value: schemaDialect}}}}
+	for _, m := range root.schema(opts).(*Object).Members {
+		schema.Set(m.Key, m.Value)
+	}
+	return schema
+}
+
+// shape summarises every value seen at one point in the samples.
+type shape struct {
+	count int
+	types map[string]bool
+
+	objects int
+	keys    []string
+	props   map[string]*shape
+
+	items *shape
+
+	strings  int
+	formats  map[string]bool
+	distinct []string
+}
+
+func newShape() *shape {
+	return &shape{types: map[string]bool{}, props: map[string]*shape{}}
+}
+
+var stringFormats = []struct {
+	name  string
+	match func(string) bool
+}{
+	{"date-time", func(s string) bool {
+		_, err := time.Parse(time.RFC3339Nano, s)
+		return err == nil
+	}},
+	{"uuid", uuidPattern.MatchString},
+	{"email", func(s string) bool {
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Name == "" && addr.Address == s
+	}},
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func (s *shape) add(v Value, opts InferOptions) {
+	s.count++
+	switch v := v.(type) {
+	case *Object:
+		s.types["object"] = true
+		s.objects++
+		for _, k := range uniqueKeys(v) {
+			p, ok := s.props[k]
+			if !ok {
+				p = newShape()
+				s.props[k] = p
+				s.keys = append(s.keys, k)
+			}
+			member, _ := v.Get(k)
+			p.add(member, opts)
+		}
+	case *Array:
+		s.types["array"] = true
+		for _, e := range v.Elems {
+			if s.items == nil {
+				s.items = newShape()
+			}
+			s.items.add(e, opts)
+		}
+	case *String:
+		s.types["string"] = true
+		s.addString(v.Value, opts)
+	case *Number:
+		r, ok := new(big.Rat).SetString(v.Literal)
+		if ok && r.IsInt() {
+			s.types["integer"] = true
+		} else {
+			s.types["number"] = true
+		}
+	default:
+		s.types[string(v.Kind())] = true
+	}
+}
+
+func (s *shape) addString(str string, opts InferOptions) {
+	if s.strings == 0 {
+		s.formats = map[string]bool{}
+		for _, f := range stringFormats {
+			s.formats[f.name] = true
+		}
+	}
+	s.strings++
+
+	for _, f := range stringFormats {
+		if s.formats[f.name] && !f.match(str) {
+			delete(s.formats, f.name)
+		}
+	}
+
+	// Only keep track of values while they could still form an enum.
+	if len(s.distinct) <= opts.MaxEnum && !slices.Contains(s.distinct, str) {
+		s.distinct = append(s.distinct, str)
+	}
+}
+
+// typeOrder is the order types are listed in a union.
+var typeOrder = []string{"null", "boolean", "integer", "number", "string", "array", "object"}
+
+func (s *shape) schema(opts InferOptions) Value {
+	schema := &Object{Members: []Member{}}
+
+	var types []Value
+	for _, t := range typeOrder {
+		if s.types[t] && !(t == "integer" && s.types["number"]) {
+			types = append(types, &String{Value: t})
+		}
+	}
+	switch len(types) {
+	case 0:
+		return schema
+	case 1:
+		schema.Set("type", types[0])
+	default:
+		schema.Set("type", &Array{Elems: types})
+	}
+
+	if s.types["string"] {
+		s.describeStrings(schema, len(types) == 1, opts)
+	}
+	if s.items != nil {
+		schema.Set("items", s.items.schema(opts))
+	}
+	if s.types["object"] {
+		props := &Object{Members: []Member{}}
+		required := &Array{Elems: []Value{}}
+		for _, k := range s.keys {
+			props.Set(k, s.props[k].schema(opts))
+			if s.props[k].count == s.objects {
+				required.Elems = append(required.Elems, &String{Value: k})
+			}
+		}
+		schema.Set("properties", props)
+		if len(required.Elems) > 0 {
+			schema.Set("required", required)
+		}
+	}
+
+	return schema
+}
+
+// describeStrings adds a format if every string had one, otherwise an enum if
+// the strings repeat a small set of values. An enum would also rule out the
+// other types in a union so it is only used for strings on their own.
+func (s *shape) describeStrings(schema *Object, only bool, opts InferOptions) {
+	for _, f := range stringFormats {
+		if s.formats[f.name] {
+			schema.Set("format", &String{Value: f.name})
+			return
+		}
+	}
+
+	if !only || len(s.distinct) > opts.MaxEnum || s.strings <= len(s.distinct) {
+		return
+	}
+	values := slices.SortedFunc(slices.Values(s.distinct), cmp.Compare[string])
+	enum := &Array{Elems: make([]Value, 0, len(values))}
+	for _, v := range values {
+		enum.Elems = append(enum.Elems, &String{Value: v})
+	}
+	schema.Set("enum", enum)
+}
@@ -0,0 +1,94 @@
+package main_test
+
+import (
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestInferSchema(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		samples []string
+		want    string
+	}{
+		{
+			desc:    "scalars",
+			samples: []string{`1`, `2`},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"integer"}`,
+		},
+		{
+			desc:    "integers widen to numbers",
+			samples: []string{`1`, `2.5`, `null`},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":["null","number"]}`,
+		},
+		{
+			desc:    "optional properties",
+			samples: []string{`{"id": 1, "name": "a"}`, `{"id": 2, "tags": []}`, `{"id": 3, "tags": [true], "name": null}`},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"object","properties":{"id":{"type":"integer"},"name":{"type":["null","string"]},"tags":{"type":"array","items":{"type":"boolean"}}},"required":["id"]}`,
+		},
+		{
+			desc:    "union of containers",
+			samples: []string{`[{"a": 1}, "x", [1]]`},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"array","items":{"type":["string","array","object"],"items":{"type":"integer"},"properties":{"a":{"type":"integer"}},"required":["a"]}}`,
+		},
+		{
+			desc: "formats",
+			samples: []string{
+				`{"at": "2024-01-02T03:04:05Z", "id": "0b7e4a3c-8f1d-4c2e-9a6b-1d2e3f4a5b6c", "by": "ann@example.com"}`,
+				`{"at": "2024-01-02T03:04:05.5+01:00", "id": "0B7E4A3C-8F1D-4C2E-9A6B-1D2E3F4A5B6C", "by": "bob@example.org"}`,
+			},
+			want: `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"object","properties":{"at":{"type":"string","format":"date-time"},"id":{"type":"string","format":"uuid"},"by":{"type":"string","format":"email"}},"required":["at","id","by"]}`,
+		},
+		{
+			desc:    "mixed formats",
+			samples: []string{`"2024-01-02T03:04:05Z"`, `"ann@example.com"`},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"string"}`,
+		},
+		{
+			desc:    "enum",
+			samples: []string{`"red"`, `"green"`, `"red"`, `"blue"`},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"string","enum":["blue","green","red"]}`,
+		},
+		{
+			desc:    "too many values for an enum",
+			samples: []string{`"a"`, `"b"`, `"c"`, `"d"`, `"a"`},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"string"}`,
+		},
+		{
+			desc:    "values never repeat",
+			samples: []string{`"a"`, `"b"`},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"string"}`,
+		},
+		{
+			desc:    "no enum in a union",
+			samples: []string{`"a"`, `"a"`, `null`},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":["null","string"]}`,
+		},
+		{
+			desc:    "no samples",
+			samples: []string{},
+			want:    `{"$schema":"https://json-schema.org/draft/2020-12/schema"}`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			samples := make([]jp.Value, 0, len(tC.samples))
+			for _, s := range tC.samples {
+				samples = append(samples, parse(t, s))
+			}
+
+			doc := jp.InferSchema(samples, jp.InferOptions{MaxEnum: 3})
+			if got := jp.FormatString(doc, jp.FormatOptions{}); got != tC.want {
+				t.Fatalf("Bad schema: got %s, want %s", got, tC.want)
+			}
+
+			schema := compileSchema(t, tC.want)
+			for i, s := range samples {
+				if err := schema.Validate(s, nil); err != nil {
+					t.Fatalf("Sample %d doesn't match: %v", i, err)
+				}
+			}
+		})
+	}
+}
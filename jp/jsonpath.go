@@ -0,0 +1,595 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInvalidQuery = errors.New("invalid JSONPath query")
+
+// QueryError points at the part of a JSONPath query that couldn't be parsed.
+// Offset is in bytes from the start of the query.
+type QueryError struct {
+	Query  string
+	Offset int
+	Msg    string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s %q: %s at offset %d", ErrInvalidQuery, e.Query, e.Msg, e.Offset)
+}
+
+func (e *QueryError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+// Query is an RFC 9535 JSONPath query, ready to be run against documents.
+type Query struct {
+	src      string
+	segments []segment
+}
+
+func (q Query) String() string {
+	return q.src
+}
+
+// Node is a value picked out by a query along with where it was found.
+type Node struct {
+	Path  Path
+	Value Value
+}
+
+// Select returns the nodes q picks out of doc, in the order the RFC
+// specifies.
+func (q Query) Select(doc Value) []Node {
+	return selectSegments(q.segments, doc, doc)
+}
+
+// Normalized renders p as an RFC 9535 normalized path, e.g. $['a'][0].
+func (p Path) Normalized() string {
+	buf := []byte{'$'}
+	for _, e := range p {
+		if e.IsIndex() {
+			buf = append(buf, '[')
+			buf = strconv.AppendInt(buf, int64(e.Index), 10)
+			buf = append(buf, ']')
+			continue
+		}
+		buf = append(buf, '[', '\'')
+		for _, r := range e.Key {
+			switch r {
+			case '\'', '\\':
+				buf = append(buf, '\\', byte(r))
+			case '\b':
+				buf = append(buf, '\\', 'b')
+			case '\f':
+				buf = append(buf, '\\', 'f')
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				if r < 0x20 {
+					buf = append(buf, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+				} else {
+					buf = utf8.AppendRune(buf, r)
+				}
+			}
+		}
+		buf = append(buf, '\'', ']')
+	}
+	return string(buf)
+}
+
+func selectSegments(segs []segment, root, start Value) []Node {
+	nodes := []Node{{Path: Path{}, Value: start}}
+	for _, seg := range segs {
+		var next []Node
+		for _, n := range nodes {
+			next = seg.apply(n, root, next)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// segment is one step of a query. A descendant segment applies its selectors
+// to the node and then to everything beneath it, visiting them in document
+// order.
+type segment struct {
+	descendant bool
+	selectors  []selector
+}
+
+func (s segment) apply(n Node, root Value, out []Node) []Node {
+	for _, sel := range s.selectors {
+		out = sel.apply(n, root, out)
+	}
+	if s.descendant {
+		for _, child := range children(n) {
+			out = s.apply(child, root, out)
+		}
+	}
+	return out
+}
+
+// singular reports whether the segment can pick out at most one node.
+func (s segment) singular() bool {
+	if s.descendant || len(s.selectors) != 1 {
+		return false
+	}
+	switch s.selectors[0].(type) {
+	case nameSelector, indexSelector:
+		return true
+	}
+	return false
+}
+
+func (n Node) child(e PathElem, v Value) Node {
+	return Node{Path: append(slices.Clip(n.Path), e), Value: v}
+}
+
+func children(n Node) []Node {
+	var out []Node
+	switch v := n.Value.(type) {
+	case *Object:
+		for _, m := range v.Members {
+			out = append(out, n.child(KeyElem(m.Key), m.Value))
+		}
+	case *Array:
+		for i, e := range v.Elems {
+			out = append(out, n.child(IndexElem(i), e))
+		}
+	}
+	return out
+}
+
+type selector interface {
+	apply(n Node, root Value, out []Node) []Node
+}
+
+type nameSelector string
+
+func (s nameSelector) apply(n Node, _ Value, out []Node) []Node {
+	if obj, ok := n.Value.(*Object); ok {
+		if v, ok := obj.Get(string(s)); ok {
+			out = append(out, n.child(KeyElem(string(s)), v))
+		}
+	}
+	return out
+}
+
+type wildcardSelector struct{}
+
+func (wildcardSelector) apply(n Node, _ Value, out []Node) []Node {
+	return append(out, children(n)...)
+}
+
+type indexSelector int
+
+func (s indexSelector) apply(n Node, _ Value, out []Node) []Node {
+	arr, ok := n.Value.(*Array)
+	if !ok {
+		return out
+	}
+	i := int(s)
+	if i < 0 {
+		i += len(arr.Elems)
+	}
+	if i >= 0 && i < len(arr.Elems) {
+		out = append(out, n.child(IndexElem(i), arr.Elems[i]))
+	}
+	return out
+}
+
+type sliceSelector struct {
+	start, end       int
+	hasStart, hasEnd bool
+	step             int
+}
+
+func (s sliceSelector) apply(n Node, _ Value, out []Node) []Node {
+	arr, ok := n.Value.(*Array)
+	if !ok || s.step == 0 {
+		return out
+	}
+
+	size := len(arr.Elems)
+	bound := func(i int) int {
+		if i < 0 {
+			i += size
+		}
+		if s.step > 0 {
+			return min(max(i, 0), size)
+		}
+		return min(max(i, -1), size-1)
+	}
+
+	if s.step > 0 {
+		lower, upper := 0, size
+		if s.hasStart {
+			lower = bound(s.start)
+		}
+		if s.hasEnd {
+			upper = bound(s.end)
+		}
+		for i := lower; i < upper; i += s.step {
+			out = append(out, n.child(IndexElem(i), arr.Elems[i]))
+		}
+		return out
+	}
+
+	upper, lower := size-1, -1
+	if s.hasStart {
+		upper = bound(s.start)
+	}
+	if s.hasEnd {
+		lower = bound(s.end)
+	}
+	for i := upper; i > lower; i += s.step {
+		out = append(out, n.child(IndexElem(i), arr.Elems[i]))
+	}
+	return out
+}
+
+type filterSelector struct {
+	cond expr
+}
+
+func (s filterSelector) apply(n Node, root Value, out []Node) []Node {
+	for _, child := range children(n) {
+		if evalLogical(s.cond, root, child.Value) {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+// exprType is the type RFC 9535 gives to the parts of a filter expression.
+type exprType int
+
+const (
+	valueType exprType = iota
+	logicalType
+	nodesType
+)
+
+// result holds whichever of these the expression's type calls for. A nil
+// value is what the RFC calls Nothing.
+type result struct {
+	value   Value
+	logical bool
+	nodes   []Node
+}
+
+type expr interface {
+	eval(root, current Value) result
+	resultType() exprType
+}
+
+// evalValue evaluates e where a single value is wanted. A query yields its
+// only node, or Nothing if it didn't find exactly one.
+func evalValue(e expr, root, current Value) Value {
+	res := e.eval(root, current)
+	if e.resultType() == nodesType {
+		if len(res.nodes) == 1 {
+			return res.nodes[0].Value
+		}
+		return nil
+	}
+	return res.value
+}
+
+// evalLogical evaluates e as a test. A query is true if it found anything.
+func evalLogical(e expr, root, current Value) bool {
+	res := e.eval(root, current)
+	if e.resultType() == nodesType {
+		return len(res.nodes) > 0
+	}
+	return res.logical
+}
+
+type literalExpr struct {
+	value Value
+}
+
+func (e *literalExpr) eval(_, _ Value) result {
+	return result{value: e.value}
+}
+
+func (*literalExpr) resultType() exprType {
+	return valueType
+}
+
+// queryExpr is a query embedded in a filter, run from either the node being
+// filtered (@) or the root of the document ($).
+type queryExpr struct {
+	relative bool
+	segments []segment
+}
+
+func (e *queryExpr) eval(root, current Value) result {
+	start := root
+	if e.relative {
+		start = current
+	}
+	return result{nodes: selectSegments(e.segments, root, start)}
+}
+
+func (*queryExpr) resultType() exprType {
+	return nodesType
+}
+
+func (e *queryExpr) singular() bool {
+	for _, seg := range e.segments {
+		if !seg.singular() {
+			return false
+		}
+	}
+	return true
+}
+
+type orExpr []expr
+
+func (e orExpr) eval(root, current Value) result {
+	for _, term := range e {
+		if evalLogical(term, root, current) {
+			return result{logical: true}
+		}
+	}
+	return result{}
+}
+
+func (orExpr) resultType() exprType {
+	return logicalType
+}
+
+type andExpr []expr
+
+func (e andExpr) eval(root, current Value) result {
+	for _, term := range e {
+		if !evalLogical(term, root, current) {
+			return result{}
+		}
+	}
+	return result{logical: true}
+}
+
+func (andExpr) resultType() exprType {
+	return logicalType
+}
+
+type notExpr struct {
+	operand expr
+}
+
+func (e *notExpr) eval(root, current Value) result {
+	return result{logical: !evalLogical(e.operand, root, current)}
+}
+
+func (*notExpr) resultType() exprType {
+	return logicalType
+}
+
+type compareExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *compareExpr) eval(root, current Value) result {
+	l := evalValue(e.left, root, current)
+	r := evalValue(e.right, root, current)
+
+	var ok bool
+	switch e.op {
+	case "==":
+		ok = sameValue(l, r)
+	case "!=":
+		ok = !sameValue(l, r)
+	case "<":
+		ok = lessValue(l, r)
+	case "<=":
+		ok = lessValue(l, r) || sameValue(l, r)
+	case ">":
+		ok = lessValue(r, l)
+	case ">=":
+		ok = lessValue(r, l) || sameValue(l, r)
+	}
+	return result{logical: ok}
+}
+
+func (*compareExpr) resultType() exprType {
+	return logicalType
+}
+
+// sameValue is equality as comparisons see it, where Nothing only equals
+// Nothing.
+func sameValue(a, b Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return Equal(a, b)
+}
+
+// lessValue orders numbers by value and strings by code point. Nothing else
+// is ordered.
+func lessValue(a, b Value) bool {
+	switch a := a.(type) {
+	case *Number:
+		b, ok := b.(*Number)
+		return ok && compareNumbers(a, b) < 0
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value < b.Value
+	}
+	return false
+}
+
+type funcExpr struct {
+	name string
+	fn   *function
+	args []expr
+
+	// pattern is the I-Regexp given to match or search, compiled along with
+	// the query if it is a literal rather than again for every node.
+	pattern *regexp.Regexp
+}
+
+func (e *funcExpr) eval(root, current Value) result {
+	args := make([]result, len(e.args))
+	for i, arg := range e.args {
+		switch e.fn.params[i] {
+		case valueType:
+			args[i].value = evalValue(arg, root, current)
+		case logicalType:
+			args[i].logical = evalLogical(arg, root, current)
+		case nodesType:
+			args[i] = arg.eval(root, current)
+		}
+	}
+	if e.pattern != nil {
+		return matchString(args[0], e.pattern)
+	}
+	return e.fn.call(args)
+}
+
+func (e *funcExpr) resultType() exprType {
+	return e.fn.result
+}
+
+// function is one of the function extensions RFC 9535 defines.
+type function struct {
+	params []exprType
+	result exprType
+	call   func(args []result) result
+
+	// compile turns the pattern taken by match and search into a regular
+	// expression, so that it can be done once if the pattern is a literal.
+	compile func(pattern string) *regexp.Regexp
+}
+
+var functions = map[string]*function{
+	"length": {
+		params: []exprType{valueType},
+		result: valueType,
+		call: func(args []result) result {
+			switch v := args[0].value.(type) {
+			case *String:
+				return countResult(utf8.RuneCountInString(v.Value))
+			case *Array:
+				return countResult(len(v.Elems))
+			case *Object:
+				return countResult(len(v.Members))
+			}
+			return result{}
+		},
+	},
+	"count": {
+		params: []exprType{nodesType},
+		result: valueType,
+		call: func(args []result) result {
+			return countResult(len(args[0].nodes))
+		},
+	},
+	"match": {
+		params: []exprType{valueType, valueType},
+		result: logicalType,
+		call: func(args []result) result {
+			return matchResult(args, true)
+		},
+		compile: func(pattern string) *regexp.Regexp {
+			return compileIRegexp(pattern, true)
+		},
+	},
+	"search": {
+		params: []exprType{valueType, valueType},
+		result: logicalType,
+		call: func(args []result) result {
+			return matchResult(args, false)
+		},
+		compile: func(pattern string) *regexp.Regexp {
+			return compileIRegexp(pattern, false)
+		},
+	},
+	"value": {
+		params: []exprType{nodesType},
+		result: valueType,
+		call: func(args []result) result {
+			if len(args[0].nodes) == 1 {
+				return result{value: args[0].nodes[0].Value}
+			}
+			return result{}
+		},
+	},
+}
+
+func countResult(n int) result {
+	return result{value: &Number{Literal: strconv.Itoa(n)}}
+}
+
+// matchResult tests the string in the first argument against the I-Regexp in
+// the second. Anything that isn't a string, or isn't a valid pattern, doesn't
+// match.
+func matchResult(args []result, whole bool) result {
+	pattern, ok := args[1].value.(*String)
+	if !ok {
+		return result{}
+	}
+	return matchString(args[0], compileIRegexp(pattern.Value, whole))
+}
+
+func matchString(arg result, re *regexp.Regexp) result {
+	s, ok := arg.value.(*String)
+	if !ok {
+		return result{}
+	}
+	return result{logical: re.MatchString(s.Value)}
+}
+
+// noMatch is what an invalid I-Regexp compiles to, as it matches nothing.
+var noMatch = regexp.MustCompile(`[^\x00-\x{10FFFF}]`)
+
+// compileIRegexp compiles an I-Regexp to match either all of a string or any
+// part of it.
+func compileIRegexp(pattern string, whole bool) *regexp.Regexp {
+	re := translateRegexp(pattern)
+	if whole {
+		re = `^(?:` + re + `)$`
+	}
+	compiled, err := regexp.Compile(re)
+	if err != nil {
+		return noMatch
+	}
+	return compiled
+}
+
+// translateRegexp converts an RFC 9485 I-Regexp to Go's syntax. The two agree
+// apart from '.', which in an I-Regexp doesn't match carriage returns either.
+func translateRegexp(pattern string) string {
+	var buf strings.Builder
+	inClass, escaped := false, false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '[':
+			inClass = true
+		case r == ']':
+			inClass = false
+		case r == '.' && !inClass:
+			buf.WriteString(`[^\n\r]`)
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
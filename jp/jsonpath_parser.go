@@ -0,0 +1,650 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxQueryInt bounds the integers a query may contain to those that survive
+// being read as an IEEE double, as RFC 9535 requires.
+const maxQueryInt = 1<<53 - 1
+
+// ParseQuery compiles an RFC 9535 JSONPath query such as
+// $.store.book[?@.price < 10].title.
+func ParseQuery(s string) (Query, error) {
+	p := queryParser{src: s}
+	if !p.consume("$") {
+		return Query{}, p.fail(0, "query must start with '$'")
+	}
+	segs, err := p.segments()
+	if err != nil {
+		return Query{}, err
+	}
+	if p.pos < len(s) {
+		return Query{}, p.fail(p.pos, "unexpected %s", p.describe())
+	}
+
+	return Query{src: s, segments: segs}, nil
+}
+
+type queryParser struct {
+	src string
+	pos int
+}
+
+func (p *queryParser) fail(pos int, format string, args ...any) error {
+	return &QueryError{Query: p.src, Offset: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) rest() string {
+	return p.src[p.pos:]
+}
+
+func (p *queryParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *queryParser) consume(s string) bool {
+	if strings.HasPrefix(p.rest(), s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// describe names whatever is at the current position for error messages.
+func (p *queryParser) describe() string {
+	if p.pos >= len(p.src) {
+		return "end of query"
+	}
+	r, _ := utf8.DecodeRuneInString(p.rest())
+	return fmt.Sprintf("%q", r)
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// segments reads segments for as long as there are any. Whitespace is only
+// consumed if a segment follows it.
+func (p *queryParser) segments() ([]segment, error) {
+	var segs []segment
+	for {
+		save := p.pos
+		p.skipSpace()
+		if c := p.peek(); c != '.' && c != '[' {
+			p.pos = save
+			return segs, nil
+		}
+		seg, err := p.segment()
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, seg)
+	}
+}
+
+func (p *queryParser) segment() (segment, error) {
+	var seg segment
+	switch {
+	case p.consume(".."):
+		seg.descendant = true
+		if p.peek() == '[' {
+			break
+		}
+		sel, err := p.shorthand("'..'")
+		seg.selectors = []selector{sel}
+		return seg, err
+	case p.consume("."):
+		sel, err := p.shorthand("'.'")
+		seg.selectors = []selector{sel}
+		return seg, err
+	}
+
+	sels, err := p.bracketed()
+	seg.selectors = sels
+	return seg, err
+}
+
+// shorthand reads the wildcard or member name that follows a dot.
+func (p *queryParser) shorthand(after string) (selector, error) {
+	if p.consume("*") {
+		return wildcardSelector{}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.rest())
+		if !isNameChar(r, p.pos == start) {
+			break
+		}
+		p.pos += size
+	}
+	if p.pos == start {
+		return nil, p.fail(start, "expected a member name or '*' after %s, got %s", after, p.describe())
+	}
+	return nameSelector(p.src[start:p.pos]), nil
+}
+
+func isNameChar(r rune, first bool) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		return true
+	case r >= '0' && r <= '9':
+		return !first
+	}
+	return r >= 0x80 && r != utf8.RuneError
+}
+
+func (p *queryParser) bracketed() ([]selector, error) {
+	p.consume("[")
+	var sels []selector
+	for {
+		p.skipSpace()
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+
+		p.skipSpace()
+		if p.consume("]") {
+			return sels, nil
+		}
+		if !p.consume(",") {
+			return nil, p.fail(p.pos, "expected ',' or ']', got %s", p.describe())
+		}
+	}
+}
+
+func (p *queryParser) selector() (selector, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		name, err := p.stringLiteral()
+		return nameSelector(name), err
+	case c == '*':
+		p.pos++
+		return wildcardSelector{}, nil
+	case c == '?':
+		p.pos++
+		p.skipSpace()
+		start := p.pos
+		cond, err := p.logicalOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkLogical(start, cond); err != nil {
+			return nil, err
+		}
+		return filterSelector{cond: cond}, nil
+	case c == '-' || c == ':' || (c >= '0' && c <= '9'):
+		return p.indexOrSlice()
+	}
+	return nil, p.fail(p.pos, "expected a selector, got %s", p.describe())
+}
+
+func (p *queryParser) indexOrSlice() (selector, error) {
+	start, hasStart, err := p.integer()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.consume(":") {
+		if !hasStart {
+			return nil, p.fail(p.pos, "expected an index, got %s", p.describe())
+		}
+		return indexSelector(start), nil
+	}
+
+	s := sliceSelector{start: start, hasStart: hasStart, step: 1}
+	p.skipSpace()
+	if s.end, s.hasEnd, err = p.integer(); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.consume(":") {
+		p.skipSpace()
+		step, hasStep, err := p.integer()
+		if err != nil {
+			return nil, err
+		}
+		if hasStep {
+			s.step = step
+		}
+	}
+	return s, nil
+}
+
+// integer reads an integer if there is one at the current position.
+func (p *queryParser) integer() (int, bool, error) {
+	start := p.pos
+	p.consume("-")
+	digits := p.pos
+	for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+		p.pos++
+	}
+
+	lit := p.src[start:p.pos]
+	switch {
+	case p.pos == digits && p.pos > start:
+		return 0, false, p.fail(start, "'-' must be followed by a digit")
+	case p.pos == digits:
+		return 0, false, nil
+	case p.src[digits] == '0' && (p.pos-digits > 1 || digits > start):
+		return 0, false, p.fail(start, "integer %s cannot lead with zero", lit)
+	}
+
+	n, err := strconv.ParseInt(lit, 10, 64)
+	if err != nil || n > maxQueryInt || n < -maxQueryInt {
+		return 0, false, p.fail(start, "integer %s is out of range", lit)
+	}
+	return int(n), true, nil
+}
+
+// stringLiteral reads a quoted string, which may use either kind of quote.
+func (p *queryParser) stringLiteral() (string, error) {
+	start := p.pos
+	quote := p.src[p.pos]
+	p.pos++
+
+	var buf strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return "", p.fail(start, "unterminated string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return buf.String(), nil
+		case c == '\\':
+			r, err := p.escape(quote)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteRune(r)
+		case c < 0x20:
+			return "", p.fail(p.pos, "unescaped control character %U in string", c)
+		default:
+			r, size := utf8.DecodeRuneInString(p.rest())
+			if r == utf8.RuneError && size == 1 {
+				return "", p.fail(p.pos, "invalid UTF-8 in string")
+			}
+			buf.WriteRune(r)
+			p.pos += size
+		}
+	}
+}
+
+// escape decodes the escape sequence at the current position.
+func (p *queryParser) escape(quote byte) (rune, error) {
+	start := p.pos
+	p.pos++
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case '/', '\\', quote:
+		return rune(c), nil
+	case 'u':
+	default:
+		return 0, p.fail(start, "invalid escape sequence %q", p.src[start:min(p.pos, len(p.src))])
+	}
+
+	r, err := p.hex4(start)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case r >= 0xdc00 && r <= 0xdfff:
+		return 0, p.fail(start, "unpaired surrogate in string")
+	case r >= 0xd800 && r <= 0xdbff:
+		if !p.consume(`\u`) {
+			return 0, p.fail(start, "unpaired surrogate in string")
+		}
+		lo, err := p.hex4(start)
+		if err != nil {
+			return 0, err
+		}
+		if lo < 0xdc00 || lo > 0xdfff {
+			return 0, p.fail(start, "unpaired surrogate in string")
+		}
+		r = 0x10000 + (r-0xd800)<<10 + (lo - 0xdc00)
+	}
+	return r, nil
+}
+
+func (p *queryParser) hex4(start int) (rune, error) {
+	if p.pos+4 > len(p.src) {
+		return 0, p.fail(start, "truncated unicode escape")
+	}
+	n, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+	if err != nil {
+		return 0, p.fail(start, "invalid unicode escape %q", p.src[start:p.pos+4])
+	}
+	p.pos += 4
+	return rune(n), nil
+}
+
+func (p *queryParser) logicalOr() (expr, error) {
+	return p.logicalChain("||", p.logicalAnd, func(terms []expr) expr { return orExpr(terms) })
+}
+
+func (p *queryParser) logicalAnd() (expr, error) {
+	return p.logicalChain("&&", p.basicExpr, func(terms []expr) expr { return andExpr(terms) })
+}
+
+// logicalChain reads terms separated by op. A lone term is returned as it is
+// so that function arguments can be plain values.
+func (p *queryParser) logicalChain(op string, term func() (expr, error), join func([]expr) expr) (expr, error) {
+	start := p.pos
+	first, err := term()
+	if err != nil {
+		return nil, err
+	}
+
+	terms := []expr{first}
+	for {
+		save := p.pos
+		p.skipSpace()
+		if !p.consume(op) {
+			p.pos = save
+			break
+		}
+		if len(terms) == 1 {
+			if err := p.checkLogical(start, first); err != nil {
+				return nil, err
+			}
+		}
+		p.skipSpace()
+		start := p.pos
+		next, err := term()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkLogical(start, next); err != nil {
+			return nil, err
+		}
+		terms = append(terms, next)
+	}
+
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return join(terms), nil
+}
+
+var comparisonOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// basicExpr reads a negation, a parenthesised expression, a comparison or
+// a single operand, leaving it to the caller to check the operand can stand
+// on its own.
+func (p *queryParser) basicExpr() (expr, error) {
+	start := p.pos
+	switch {
+	case p.consume("!"):
+		p.skipSpace()
+		start := p.pos
+		operand, err := p.notOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkLogical(start, operand); err != nil {
+			return nil, err
+		}
+		return &notExpr{operand: operand}, nil
+	case p.peek() == '(':
+		return p.paren()
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	save := p.pos
+	p.skipSpace()
+	op := ""
+	for _, candidate := range comparisonOps {
+		if p.consume(candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		p.pos = save
+		return left, nil
+	}
+
+	if err := p.checkValue(start, left); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	start = p.pos
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkValue(start, right); err != nil {
+		return nil, err
+	}
+
+	return &compareExpr{op: op, left: left, right: right}, nil
+}
+
+func (p *queryParser) notOperand() (expr, error) {
+	if p.peek() == '(' {
+		return p.paren()
+	}
+	return p.operand()
+}
+
+func (p *queryParser) paren() (expr, error) {
+	p.consume("(")
+	p.skipSpace()
+	start := p.pos
+	e, err := p.logicalOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkLogical(start, e); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.consume(")") {
+		return nil, p.fail(p.pos, "expected ')', got %s", p.describe())
+	}
+	return e, nil
+}
+
+// operand reads an embedded query, a literal or a function call.
+func (p *queryParser) operand() (expr, error) {
+	start := p.pos
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		p.pos++
+		segs, err := p.segments()
+		if err != nil {
+			return nil, err
+		}
+		return &queryExpr{relative: c == '@', segments: segs}, nil
+	case c == '\'' || c == '"':
+		s, err := p.stringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		return &literalExpr{value: &String{Value: s}}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.number()
+	case c >= 'a' && c <= 'z':
+	default:
+		return nil, p.fail(start, "expected an expression, got %s", p.describe())
+	}
+
+	for c := p.peek(); (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_'; c = p.peek() {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+	if p.peek() == '(' {
+		return p.call(start, name)
+	}
+
+	switch name {
+	case "true", "false":
+		return &literalExpr{value: &Bool{Value: name == "true"}}, nil
+	case "null":
+		return &literalExpr{value: &Null{}}, nil
+	}
+	return nil, p.fail(start, "unexpected %q", name)
+}
+
+func (p *queryParser) number() (expr, error) {
+	start := p.pos
+	p.consume("-")
+	digits := p.pos
+	for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+		p.pos++
+	}
+	switch {
+	case p.pos == digits:
+		return nil, p.fail(start, "'-' must be followed by a digit")
+	case p.src[digits] == '0' && p.pos-digits > 1:
+		return nil, p.fail(start, "numbers cannot lead with zero")
+	}
+
+	if p.consume(".") {
+		frac := p.pos
+		for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+			p.pos++
+		}
+		if p.pos == frac {
+			return nil, p.fail(start, "'.' must be followed by a digit")
+		}
+	}
+	if c := p.peek(); c == 'e' || c == 'E' {
+		p.pos++
+		if c := p.peek(); c == '+' || c == '-' {
+			p.pos++
+		}
+		exp := p.pos
+		for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+			p.pos++
+		}
+		if p.pos == exp {
+			return nil, p.fail(start, "exponent must be followed by a digit")
+		}
+	}
+
+	return &literalExpr{value: &Number{Literal: p.src[start:p.pos]}}, nil
+}
+
+func (p *queryParser) call(start int, name string) (expr, error) {
+	fn, ok := functions[name]
+	if !ok {
+		return nil, p.fail(start, "unknown function %s()", name)
+	}
+	p.consume("(")
+
+	var args []expr
+	p.skipSpace()
+	if !p.consume(")") {
+		for {
+			p.skipSpace()
+			argStart := p.pos
+			arg, err := p.logicalOr()
+			if err != nil {
+				return nil, err
+			}
+			if len(args) < len(fn.params) {
+				if err := p.checkArg(argStart, name, fn.params[len(args)], arg); err != nil {
+					return nil, err
+				}
+			}
+			args = append(args, arg)
+
+			p.skipSpace()
+			if p.consume(")") {
+				break
+			}
+			if !p.consume(",") {
+				return nil, p.fail(p.pos, "expected ',' or ')', got %s", p.describe())
+			}
+		}
+	}
+
+	if len(args) != len(fn.params) {
+		return nil, p.fail(start, "%s() takes %d arguments, got %d", name, len(fn.params), len(args))
+	}
+	e := &funcExpr{name: name, fn: fn, args: args}
+	if lit, ok := args[len(args)-1].(*literalExpr); ok && fn.compile != nil {
+		if pattern, ok := lit.value.(*String); ok {
+			e.pattern = fn.compile(pattern.Value)
+		}
+	}
+	return e, nil
+}
+
+// checkLogical makes sure e can be used as a test on its own.
+func (p *queryParser) checkLogical(pos int, e expr) error {
+	switch e := e.(type) {
+	case *literalExpr:
+		return p.fail(pos, "a literal must be compared with something")
+	case *funcExpr:
+		if e.resultType() == valueType {
+			return p.fail(pos, "the result of %s() must be compared with something", e.name)
+		}
+	}
+	return nil
+}
+
+// checkValue makes sure e can be used where a single value is wanted.
+func (p *queryParser) checkValue(pos int, e expr) error {
+	switch e := e.(type) {
+	case *literalExpr:
+		return nil
+	case *queryExpr:
+		if !e.singular() {
+			return p.fail(pos, "only a singular query can be used as a value")
+		}
+		return nil
+	case *funcExpr:
+		if e.resultType() != valueType {
+			return p.fail(pos, "%s() does not produce a value", e.name)
+		}
+		return nil
+	}
+	return p.fail(pos, "expected a value, got a logical expression")
+}
+
+func (p *queryParser) checkArg(pos int, name string, want exprType, arg expr) error {
+	switch want {
+	case valueType:
+		return p.checkValue(pos, arg)
+	case logicalType:
+		return p.checkLogical(pos, arg)
+	}
+	if _, ok := arg.(*queryExpr); !ok {
+		return p.fail(pos, "%s() expects a query", name)
+	}
+	return nil
+}
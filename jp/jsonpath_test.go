@@ -0,0 +1,227 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+const bookstoreDoc = `{ "store": {
+	"book": [
+		{ "category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95 },
+		{ "category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99 },
+		{ "category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99 },
+		{ "category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99 }
+	],
+	"bicycle": { "color": "red", "price": 399 }
+} }`
+
+// selectAll runs query against doc, returning each match formatted compactly.
+func selectAll(t *testing.T, query string, doc jp.Value) []string {
+	t.Helper()
+	q, err := jp.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := []string{}
+	for _, n := range q.Select(doc) {
+		got = append(got, jp.FormatString(n.Value, jp.FormatOptions{}))
+	}
+	return got
+}
+
+func TestQueryBookstore(t *testing.T) {
+	testCases := []struct {
+		query string
+		want  string
+	}{
+		{query: "$.store.book[*].author", want: `"Nigel Rees" "Evelyn Waugh" "Herman Melville" "J. R. R. Tolkien"`},
+		{query: "$..author", want: `"Nigel Rees" "Evelyn Waugh" "Herman Melville" "J. R. R. Tolkien"`},
+		{query: "$.store..price", want: `8.95 12.99 8.99 22.99 399`},
+		{query: "$..book[2]", want: `{"category":"fiction","author":"Herman Melville","title":"Moby Dick","isbn":"0-553-21311-3","price":8.99}`},
+		{query: "$..book[2].author", want: `"Herman Melville"`},
+		{query: "$..book[2].publisher", want: ``},
+		{query: "$..book[-1].title", want: `"The Lord of the Rings"`},
+		{query: "$..book[0,1].title", want: `"Sayings of the Century" "Sword of Honour"`},
+		{query: "$..book[:2].title", want: `"Sayings of the Century" "Sword of Honour"`},
+		{query: "$..book[?@.isbn].title", want: `"Moby Dick" "The Lord of the Rings"`},
+		{query: "$..book[?@.price<10].title", want: `"Sayings of the Century" "Moby Dick"`},
+		{query: "$.store.book[?@.price < 10 && @.category == 'fiction'].title", want: `"Moby Dick"`},
+		{query: "$.store.book[?!(@.price < 10)].title", want: `"Sword of Honour" "The Lord of the Rings"`},
+		{query: "$.store.book[?@.author == $.store.book[1].author].price", want: `12.99`},
+		{query: `$.store.book[?match(@.author, "J.*")].title`, want: `"The Lord of the Rings"`},
+		{query: `$.store.book[?search(@.title, "of")].title`, want: `"Sayings of the Century" "Sword of Honour" "The Lord of the Rings"`},
+		{query: `$.store[?length(@) == 2]`, want: `{"color":"red","price":399}`},
+		{query: `$.store.book[?count(@.*) > 4].title`, want: `"Moby Dick" "The Lord of the Rings"`},
+		{query: `$.store.book[?value(@..isbn) == "0-553-21311-3"].title`, want: `"Moby Dick"`},
+		{query: `$["store"]['bicycle'][ 'color' , "price" ]`, want: `"red" 399`},
+	}
+	doc := parse(t, bookstoreDoc)
+	for _, tC := range testCases {
+		t.Run(tC.query, func(t *testing.T) {
+			got := strings.Join(selectAll(t, tC.query, doc), " ")
+			if got != tC.want {
+				t.Fatalf("Bad matches: got %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestQuerySelectors(t *testing.T) {
+	testCases := []struct {
+		query string
+		doc   string
+		want  string
+	}{
+		{query: "$", doc: `[1]`, want: `[1]`},
+		{query: "$[*]", doc: `{"o": {"j": 1, "k": 2}, "a": [5, 3]}`, want: `{"j":1,"k":2} [5,3]`},
+		{query: "$.o[*, *]", doc: `{"o": {"j": 1, "k": 2}}`, want: `1 2 1 2`},
+		{query: "$[1]", doc: `["a", "b"]`, want: `"b"`},
+		{query: "$[-2]", doc: `["a", "b"]`, want: `"a"`},
+		{query: "$[2]", doc: `["a", "b"]`, want: ``},
+		{query: "$[0]", doc: `{"0": 1}`, want: ``},
+		{query: "$[1:3]", doc: `["a", "b", "c", "d", "e", "f", "g"]`, want: `"b" "c"`},
+		{query: "$[5:]", doc: `["a", "b", "c", "d", "e", "f", "g"]`, want: `"f" "g"`},
+		{query: "$[1:5:2]", doc: `["a", "b", "c", "d", "e", "f", "g"]`, want: `"b" "d"`},
+		{query: "$[5:1:-2]", doc: `["a", "b", "c", "d", "e", "f", "g"]`, want: `"f" "d"`},
+		{query: "$[::-1]", doc: `["a", "b", "c", "d", "e", "f", "g"]`, want: `"g" "f" "e" "d" "c" "b" "a"`},
+		{query: "$[::0]", doc: `["a", "b"]`, want: ``},
+		{query: "$[-100:100]", doc: `["a", "b"]`, want: `"a" "b"`},
+		{query: "$..j", doc: `{"o": {"j": 1, "k": 2}, "a": [{"j": 3}, [{"j": 4}]]}`, want: `1 3 4`},
+		{query: "$..[0]", doc: `{"o": [5, [6]], "a": [7]}`, want: `5 6 7`},
+		{query: "$.a..*", doc: `{"a": [1, {"b": 2}]}`, want: `1 {"b":2} 2`},
+		{query: "$.o.été", doc: `{"o": {"été": 1}}`, want: `1`},
+		{query: `$['été', 'it\'s']`, doc: `{"été": 1, "it's": 2}`, want: `1 2`},
+		{query: `$["𝄞"]`, doc: `{"𝄞": 1}`, want: `1`},
+		{query: "$[?@.a == null]", doc: `[{"a": null}, {"b": 1}, {"a": 1}]`, want: `{"a":null}`},
+		{query: "$[?@.a == @.b]", doc: `[{"a": 1}, {"b": 1}, {}, {"a": 2, "b": 2.0}]`, want: `{} {"a":2,"b":2.0}`},
+		{query: "$[?@.a != 1]", doc: `[{"a": 1}, {"a": "1"}, {}]`, want: `{"a":"1"} {}`},
+		{query: "$[?@ > 'b']", doc: `["a", "b", "c", 1, true]`, want: `"c"`},
+		{query: "$[?@ <= 1]", doc: `[0, 1, 1.5, "1", null]`, want: `0 1`},
+		{query: "$[?@ >= -1e1]", doc: `[-20, -10, 0]`, want: `-10 0`},
+		{query: "$[?@.a == $.x]", doc: `{"x": {"k": [1]}, "y": {"a": {"k": [1.0]}}}`, want: `{"a":{"k":[1.0]}}`},
+		{query: "$[?@.a || @.b && @.c]", doc: `[{"a": 1}, {"b": 1}, {"b": 1, "c": 1}]`, want: `{"a":1} {"b":1,"c":1}`},
+		{query: "$[?(@.a || @.b) && @.c]", doc: `[{"a": 1}, {"b": 1}, {"b": 1, "c": 1}]`, want: `{"b":1,"c":1}`},
+		{query: "$[?!@.a]", doc: `[{"a": false}, {"b": 1}]`, want: `{"b":1}`},
+		{query: "$[?@.*]", doc: `[[], [1], {}, {"a": 1}, 2]`, want: `[1] {"a":1}`},
+		{query: "$[?length(@) > 1]", doc: `["a", "ab", [1, 2], {"a": 1}, 10]`, want: `"ab" [1,2]`},
+		{query: "$[?length(@.x) == 2]", doc: `[{"x": "ü🙂"}]`, want: `{"x":"ü🙂"}`},
+		{query: `$[?match(@, "a.c")]`, doc: `["abc", "a\rc", "xabc"]`, want: `"abc"`},
+		{query: `$[?search(@, "[a.]c")]`, doc: `["xac", "a.c", "abc"]`, want: `"xac" "a.c"`},
+		{query: `$[?match(@, "(")]`, doc: `["("]`, want: ``},
+		{query: "$[?match(@.s, @.p)]", doc: `[{"s": "ab", "p": "a."}, {"s": "ab", "p": "b"}, {"s": "(", "p": "("}]`, want: `{"s":"ab","p":"a."}`},
+		{query: "$[?search(@.s, $[0].p)]", doc: `[{"s": "ab", "p": "b"}, {"s": "ba"}, {"s": "a"}]`, want: `{"s":"ab","p":"b"} {"s":"ba"}`},
+		{query: "$[?true == true]", doc: `[1, 2]`, want: `1 2`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.query, func(t *testing.T) {
+			got := strings.Join(selectAll(t, tC.query, parse(t, tC.doc)), " ")
+			if got != tC.want {
+				t.Fatalf("Bad matches: got %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestQueryPaths(t *testing.T) {
+	doc := parse(t, `{"a": [{"b'c": 1}, {"b'c": 2}], "d\n": {"e": 3}}`)
+	q, err := jp.ParseQuery("$..*")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{
+		`$['a']`,
+		`$['d\n']`,
+		`$['a'][0]`,
+		`$['a'][1]`,
+		`$['a'][0]['b\'c']`,
+		`$['a'][1]['b\'c']`,
+		`$['d\n']['e']`,
+	}
+	nodes := q.Select(doc)
+	if len(nodes) != len(want) {
+		t.Fatalf("Bad match count: got %d, want %d", len(nodes), len(want))
+	}
+	for i, n := range nodes {
+		if got := n.Path.Normalized(); got != want[i] {
+			t.Fatalf("Bad path %d: got %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestBadQueries(t *testing.T) {
+	testCases := []struct {
+		query  string
+		offset int
+	}{
+		{query: "", offset: 0},
+		{query: "store", offset: 0},
+		{query: " $", offset: 0},
+		{query: "$ ", offset: 1},
+		{query: "$.", offset: 2},
+		{query: "$.1a", offset: 2},
+		{query: "$. a", offset: 2},
+		{query: "$..", offset: 3},
+		{query: "$[", offset: 2},
+		{query: "$[0", offset: 3},
+		{query: "$[0,]", offset: 4},
+		{query: "$[01]", offset: 2},
+		{query: "$[-0]", offset: 2},
+		{query: "$[9007199254740992]", offset: 2},
+		{query: "$['a]", offset: 2},
+		{query: `$['\a']`, offset: 3},
+		{query: `$['\ud800']`, offset: 3},
+		{query: "$[?@.a == 1 ", offset: 12},
+		{query: "$[?1]", offset: 3},
+		{query: "$[?@.* == 1]", offset: 3},
+		{query: "$[?@..a == 1]", offset: 3},
+		{query: "$[?length(@)]", offset: 3},
+		{query: "$[?count(1) == 1]", offset: 9},
+		{query: "$[?length(@.*) == 1]", offset: 10},
+		{query: "$[?match(@) == 1]", offset: 3},
+		{query: "$[?match(@, 'a') == true]", offset: 3},
+		{query: "$[?foo(@)]", offset: 3},
+		{query: "$[?@.a == nul]", offset: 10},
+		{query: "$[?!@.a == 1]", offset: 8},
+		{query: "$[?@ == [1]]", offset: 8},
+		{query: "$[?(@.a]", offset: 7},
+		{query: "$[?@.a = 1]", offset: 7},
+		{query: "$[?@.a == 01]", offset: 10},
+		{query: "$[?@.a == 1.]", offset: 10},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.query, func(t *testing.T) {
+			_, err := jp.ParseQuery(tC.query)
+			if !errors.Is(err, jp.ErrInvalidQuery) {
+				t.Fatalf("Bad error: got %v, want %v", err, jp.ErrInvalidQuery)
+			}
+			var qe *jp.QueryError
+			if !errors.As(err, &qe) {
+				t.Fatalf("Bad error type: got %T, want *QueryError", err)
+			}
+			if qe.Offset != tC.offset {
+				t.Fatalf("Bad offset: got %d, want %d (%v)", qe.Offset, tC.offset, err)
+			}
+		})
+	}
+}
+
+func BenchmarkQueryMatch(b *testing.B) {
+	p := jp.NewParser(bytes.NewReader(benchmarkDocument(1 << 20)))
+	doc, err := p.Parse()
+	if err != nil {
+		b.Fatalf("Unexpected error: %v", err)
+	}
+	q, err := jp.ParseQuery(`$..[?match(@.name, "user [0-9]*7")]`)
+	if err != nil {
+		b.Fatalf("Unexpected error: %v", err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		q.Select(doc)
+	}
+}
@@ -1,267 +1,1015 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"strings"
 	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
+// maxLineWindow bounds how much of the current line the lexer remembers for
+// error snippets so that single line (e.g. minified) inputs don't have to be
+// held in memory.
+const maxLineWindow = 1024
+
+const (
+	// minRead is the least room the lexer leaves for each read and the size
+	// of its first buffer, which suits small documents.
+	minRead = 4 * 1024
+	// maxRead is the buffer size the lexer works up to on large inputs.
+	maxRead = 64 * 1024
+)
+
+// Lexer splits its input into tokens. It scans bytes read into a buffer in
+// large blocks, only decoding UTF-8 inside strings or where a character
+// outside ASCII turns up between tokens.
 type Lexer struct {
-	src *bufio.Reader
-	c   rune
-	err error
-	row int
-	col int
+	src      io.Reader
+	err      error
+	relaxed  bool
+	sequence bool
+	ijson    bool
+
+	// buf holds the input from offset off, i indexing the next byte to be
+	// lexed, which is at line and col.
+	buf  []byte
+	off  int
+	i    int
+	line int
+	col  int
+
+	// token is where in buf the token being lexed starts, or -1 between
+	// tokens. It is kept in buf until done along with up to maxLineWindow
+	// bytes of the current line from lineStart, which is at column lineCol.
+	token     int
+	lineStart int
+	lineCol   int
+
+	// While lexing a string the text from run, relative to token, has yet to
+	// be copied to val if the string has escapes and so decodes to something
+	// other than its raw text. val is reused from one string to the next.
+	run       int
+	val       []byte
+	unescaped bool
 }
 
 func NewLexer(src io.Reader) Lexer {
-	lx := Lexer{
-		src: bufio.NewReader(src),
-	}
-	lx.row = 1
-	lx.readRune()
+	return newLexer(src, Options{})
+}
 
-	return lx
+// NewRelaxedLexer reads JSON5: it skips comments and accepts single quoted
+// strings and the extended number syntax.
+func NewRelaxedLexer(src io.Reader) Lexer {
+	return newLexer(src, Options{Relaxed: true})
 }
 
-func (lx *Lexer) NextToken() Token {
-	lx.skipWhitespace()
+// newLexer reads the dialect the options ask for: JSON5 if Relaxed, RS
+// separators if Sequence and only valid Unicode in strings if IJSON.
+func newLexer(src io.Reader, opts Options) Lexer {
+	return Lexer{
+		src:      src,
+		relaxed:  opts.Relaxed,
+		sequence: opts.Sequence,
+		ijson:    opts.IJSON,
+		line:     1,
+		col:      1,
+		token:    -1,
+		lineCol:  1,
+	}
+}
 
-	if lx.err == io.EOF {
-		return NewTokenFromString(EOF, "", lx.row)
+func (lx *Lexer) NextToken() Token {
+	lx.token = -1
+	c, ok := lx.skipWhitespace()
+	for lx.relaxed && ok && c == '/' {
+		start := lx.pos()
+		if err := lx.skipComment(); err != nil {
+			return lx.illegal("bad comment", err, start)
+		}
+		c, ok = lx.skipWhitespace()
 	}
-	if lx.err != nil {
-		return NewTokenFromString(
-			ILLEGAL,
-			fmt.Sprintf("bad token %q: %s", lx.c, lx.err),
-			lx.row,
-		)
+
+	start := lx.pos()
+	if !ok {
+		if lx.err == io.EOF {
+			return NewTokenFromString(EOF, "", start, start)
+		}
+		tok := NewTokenFromString(ILLEGAL, fmt.Sprintf("bad token: %s", lx.err), start, start)
+		tok.Err = lx.err
+		return tok
 	}
 
-	var tok Token
-	switch lx.c {
+	lx.token = lx.i
+	switch c {
 	case '{':
-		tok = NewTokenFromRune(LBRACE, lx.c, lx.row)
+		return lx.punctuation(LBRACE, start)
 	case '}':
-		tok = NewTokenFromRune(RBRACE, lx.c, lx.row)
+		return lx.punctuation(RBRACE, start)
 	case '[':
-		tok = NewTokenFromRune(LBRCKT, lx.c, lx.row)
+		return lx.punctuation(LBRCKT, start)
 	case ']':
-		tok = NewTokenFromRune(RBRCKT, lx.c, lx.row)
+		return lx.punctuation(RBRCKT, start)
 	case ':':
-		tok = NewTokenFromRune(COLON, lx.c, lx.row)
+		return lx.punctuation(COLON, start)
 	case ',':
-		tok = NewTokenFromRune(COMMA, lx.c, lx.row)
+		return lx.punctuation(COMMA, start)
 	case '"':
-		str, err := lx.readString()
-		if err != nil {
-			tok = NewTokenFromString(
-				ILLEGAL,
-				fmt.Sprintf("bad string: %s", err),
-				lx.row,
-			)
-			break
+		return lx.stringToken(start)
+	case '\'':
+		if lx.relaxed {
+			return lx.stringToken(start)
 		}
-		tok = NewTokenFromString(STRING, str, lx.row)
 	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		num, err := lx.readNumber()
-		if err != nil {
-			tok = NewTokenFromString(
-				ILLEGAL,
-				fmt.Sprintf("bad number: %s", err),
-				lx.row,
-			)
-			break
+		if lx.relaxed {
+			return lx.relaxedNumberToken(start)
 		}
-		tok = NewTokenFromString(NUM, num, lx.row)
-	default:
-		if unicode.IsLetter(lx.c) || lx.c == '_' {
-			ident := lx.readIdentifier()
-			tok = NewTokenFromString(lookupIdentifier(ident), ident, lx.row)
-		} else {
-			tok = NewTokenFromString(
-				ILLEGAL,
-				fmt.Sprintf("unrecognised token: %v", string(lx.c)),
-				lx.row,
-			)
+		return lx.numberToken(start)
+	case '+', '.':
+		if lx.relaxed {
+			return lx.relaxedNumberToken(start)
+		}
+	case '\x1e':
+		if lx.sequence {
+			return lx.punctuation(RS, start)
 		}
 	}
 
-	lx.readRune()
+	if r := lx.current(); unicode.IsLetter(r) || r == '_' || lx.relaxed && r == '$' {
+		return lx.identifierToken(start)
+	}
+	err := lx.errorAt(start, ErrUnrecognisedToken, "unrecognised token: %v", string(lx.current()))
+	lx.advance()
+	return lx.illegal("bad token", err, start)
+}
+
+// illegal builds an ILLEGAL token whose End marks the character the lexer
+// could not make sense of.
+func (lx *Lexer) illegal(what string, err error, start Position) Token {
+	bad := lx.pos()
+	var le *lexError
+	if errors.As(err, &le) {
+		bad = le.pos
+	}
+
+	tok := NewTokenFromString(
+		ILLEGAL,
+		fmt.Sprintf("%s: %s", what, err),
+		start,
+		bad,
+	)
+	tok.Err = err
 
 	return tok
 }
 
-func (lx *Lexer) readRune() {
-	lx.c, _, lx.err = lx.src.ReadRune()
-	if lx.c == '\n' {
-		lx.row++
+func (lx *Lexer) errorAt(pos Position, cause error, format string, args ...any) error {
+	return &lexError{
+		pos:   pos,
+		msg:   fmt.Sprintf(format, args...),
+		cause: cause,
+	}
+}
+
+// pos is the position of the next byte to be lexed.
+func (lx *Lexer) pos() Position {
+	return Position{Offset: lx.off + lx.i, Line: lx.line, Col: lx.col}
+}
+
+// ahead is the position n bytes past the next one. Lookahead is only ever
+// over ASCII so this is also n characters on.
+func (lx *Lexer) ahead(n int) Position {
+	pos := lx.pos()
+	pos.Offset += n
+	pos.Col += n
+	return pos
+}
+
+// peek returns the byte n past the next one to be lexed, reporting false if
+// the input ends before it.
+func (lx *Lexer) peek(n int) (byte, bool) {
+	if lx.i+n >= len(lx.buf) && !lx.fill(n+1) {
+		return 0, false
+	}
+	return lx.buf[lx.i+n], true
+}
+
+// current decodes the next character, which must have been peeked.
+func (lx *Lexer) current() rune {
+	if c := lx.buf[lx.i]; c < utf8.RuneSelf {
+		return rune(c)
+	}
+	r, _ := lx.decode()
+	return r
+}
+
+func (lx *Lexer) decode() (rune, int) {
+	if !utf8.FullRune(lx.buf[lx.i:]) {
+		lx.fill(utf8.UTFMax)
+	}
+	return utf8.DecodeRune(lx.buf[lx.i:])
+}
+
+// skip moves past n bytes known to be ASCII other than a line feed.
+func (lx *Lexer) skip(n int) {
+	lx.i += n
+	lx.col += n
+}
+
+// advance moves past the next character, which must have been peeked.
+func (lx *Lexer) advance() {
+	switch c := lx.buf[lx.i]; {
+	case c == '\n':
+		lx.i++
+		lx.line++
 		lx.col = 1
-	} else {
+		lx.lineStart, lx.lineCol = lx.i, 1
+	case c < utf8.RuneSelf:
+		lx.skip(1)
+	default:
+		_, size := lx.decode()
+		lx.i += size
 		lx.col++
 	}
 }
 
-func (lx *Lexer) peek(num int) ([]rune, error) {
-	next, err := lx.src.Peek(num)
-	if err != nil && err != io.EOF {
-		return nil, err
+// mark notes how far into the current token the lexer has got. Indices into
+// buf don't survive a read, so positions within a token are kept this way.
+func (lx *Lexer) mark() int {
+	return lx.i - lx.token
+}
+
+// since is the input from a mark up to the next byte to be lexed.
+func (lx *Lexer) since(m int) []byte {
+	return lx.buf[lx.token+m : lx.i]
+}
+
+// fill reads until at least n bytes are buffered from i, reporting false if
+// the input ran out first.
+func (lx *Lexer) fill(n int) bool {
+	for empty := 0; len(lx.buf)-lx.i < n; {
+		if lx.err != nil {
+			return false
+		}
+		lx.compact()
+
+		read, err := lx.src.Read(lx.buf[len(lx.buf):cap(lx.buf)])
+		lx.buf = lx.buf[:len(lx.buf)+read]
+		switch {
+		case err != nil:
+			lx.err = err
+		case read > 0:
+			empty = 0
+		default:
+			if empty++; empty == 100 {
+				lx.err = io.ErrNoProgress
+			}
+		}
+	}
+	return true
+}
+
+// compact makes room in buf for another read by dropping what has been lexed
+// and is no longer needed. The buffer starts small and doubles up to maxRead
+// while the input keeps coming, growing past that only to hold a token or
+// line window that doesn't fit.
+func (lx *Lexer) compact() {
+	if lx.i-lx.lineStart > maxLineWindow {
+		cut := lx.i - maxLineWindow/2
+		if lx.token >= 0 {
+			cut = min(cut, lx.token)
+		}
+		for cut < lx.i && !utf8.RuneStart(lx.buf[cut]) {
+			cut++
+		}
+		if cut > lx.lineStart {
+			lx.lineCol += utf8.RuneCount(lx.buf[lx.lineStart:cut])
+			lx.lineStart = cut
+		}
+	}
+
+	keep := lx.lineStart
+	if lx.token >= 0 {
+		keep = min(keep, lx.token)
+	}
+	if keep > 0 {
+		lx.buf = lx.buf[:copy(lx.buf, lx.buf[keep:])]
+		lx.off += keep
+		lx.i -= keep
+		lx.lineStart -= keep
+		if lx.token >= 0 {
+			lx.token -= keep
+		}
+	}
+
+	size := cap(lx.buf)
+	switch {
+	case size == 0:
+		size = minRead
+	case size < maxRead:
+		size *= 2
+	}
+	if size-len(lx.buf) < minRead {
+		size = 2*len(lx.buf) + minRead
+	}
+	if size != cap(lx.buf) {
+		buf := make([]byte, len(lx.buf), size)
+		copy(buf, lx.buf)
+		lx.buf = buf
+	}
+}
+
+// punctuation makes a token of the next byte. Go interns single byte strings,
+// so unlike NewTokenFromRune this doesn't allocate.
+func (lx *Lexer) punctuation(tt TokenType, start Position) Token {
+	lit := string(lx.buf[lx.i : lx.i+1])
+	lx.skip(1)
+	return NewTokenFromString(tt, lit, start, lx.pos())
+}
+
+// skipWhitespace moves to the next byte that isn't whitespace and returns it,
+// reporting false at the end of the input.
+func (lx *Lexer) skipWhitespace() (byte, bool) {
+	for {
+		for lx.i < len(lx.buf) {
+			switch c := lx.buf[lx.i]; c {
+			case ' ', '\t', '\r':
+				lx.skip(1)
+			case '\n':
+				lx.advance()
+			default:
+				if !lx.relaxed || !isRelaxedSpace(lx.current()) {
+					return c, true
+				}
+				lx.advance()
+			}
+		}
+		if !lx.fill(1) {
+			return 0, false
+		}
 	}
-	runes := make([]rune, 0, num)
+}
 
-	for _, n := range next {
-		runes = append(runes, rune(n))
+// isRelaxedSpace reports whether JSON5 counts c as whitespace on top of that
+// allowed by JSON.
+func isRelaxedSpace(c rune) bool {
+	switch c {
+	case '\v', '\f', '\ufeff', '\u2028', '\u2029':
+		return true
 	}
+	return unicode.Is(unicode.Zs, c)
+}
 
-	return runes, err
+// isLineTerminator reports whether c ends a // comment, which in JSON5 is
+// any of the line terminators of ECMAScript 5.1.
+func isLineTerminator(c rune) bool {
+	return c == '\n' || c == '\r' || c == '\u2028' || c == '\u2029'
 }
 
-func (lx *Lexer) skipWhitespace() {
-	if lx.err != nil {
-		return
+// skipComment moves past a // or /* */ comment. A lone slash is skipped too
+// so that lexing carries on after it.
+func (lx *Lexer) skipComment() error {
+	start := lx.pos()
+	next, _ := lx.peek(1)
+	if next != '/' && next != '*' {
+		lx.skip(1)
+		return lx.errorAt(start, ErrUnrecognisedToken, "unrecognised token: /")
 	}
-	for lx.c == ' ' || lx.c == '\t' || lx.c == '\n' || lx.c == '\r' {
-		lx.readRune()
+
+	lx.skip(2)
+	for {
+		c, ok := lx.peek(0)
+		switch {
+		case !ok && next == '*':
+			return lx.errorAt(lx.pos(), ErrUnterminatedComment, "unterminated comment")
+		case !ok, next == '/' && isLineTerminator(lx.current()):
+			return nil
+		case next == '*' && c == '*':
+			if end, _ := lx.peek(1); end == '/' {
+				lx.skip(2)
+				return nil
+			}
+		}
+		lx.advance()
 	}
 }
 
-func (lx *Lexer) readNumber() (string, error) {
-	var buf strings.Builder
+func (lx *Lexer) numberToken(start Position) Token {
+	if err := lx.scanNumber(); err != nil {
+		return lx.badNumber(err, start)
+	}
+	return NewTokenFromString(NUM, string(lx.buf[lx.token:lx.i]), start, lx.pos())
+}
 
-	if err := lx.readIntegralPart(&buf); err != nil {
-		return "", err
+// badNumber makes sure the lexer has moved on from a number it has given up
+// on before reporting it.
+func (lx *Lexer) badNumber(err error, start Position) Token {
+	if lx.i == lx.token {
+		lx.skip(1)
 	}
-	if err := lx.readFractionalPart(&buf); err != nil {
-		return "", err
+	return lx.illegal("bad number", err, start)
+}
+
+// scanNumber moves past a JSON number. If it isn't one the lexer is left on
+// the character that shows it.
+func (lx *Lexer) scanNumber() error {
+	c, _ := lx.peek(0)
+	if c == '-' {
+		next, ok := lx.peek(1)
+		switch {
+		case !ok:
+			return lx.errorAt(lx.ahead(1), ErrInvalidNumber, "truncated integral part")
+		case !isDigit(next):
+			return lx.errorAt(lx.ahead(1), ErrInvalidNumber, "'-' must be followed by a digit")
+		}
+		lx.skip(1)
+		c = next
+	}
+	lx.skip(1)
+	if next, ok := lx.peek(0); c == '0' && ok && isDigit(next) {
+		return lx.errorAt(lx.pos(), ErrLeadingZero, "numbers cannot lead with zero")
+	}
+	lx.skipDigits()
+
+	if c, ok := lx.peek(0); ok && c == '.' {
+		next, ok := lx.peek(1)
+		switch {
+		case !ok:
+			return lx.errorAt(lx.ahead(1), ErrInvalidNumber, "truncated fractional part")
+		case !isDigit(next):
+			return lx.errorAt(lx.ahead(1), ErrInvalidNumber, "'.' must be followed by a digit")
+		}
+		lx.skip(1)
+		lx.skipDigits()
 	}
-	if err := lx.readExponent(&buf); err != nil {
+
+	return lx.scanExponent()
+}
+
+func (lx *Lexer) scanExponent() error {
+	if c, ok := lx.peek(0); !ok || c != 'e' && c != 'E' {
+		return nil
+	}
+
+	next, ok := lx.peek(1)
+	switch {
+	// We start the exponential part but don't have a value
+	case !ok:
+		return lx.errorAt(lx.ahead(1), ErrInvalidNumber, "truncated exponent")
+	// Valid, unsigned exponential part e.g. e2, E42, etc
+	case isDigit(next):
+		lx.skip(1)
+	// The 'e' is followed by an invalid character
+	case next != '+' && next != '-':
+		return lx.errorAt(lx.ahead(1), ErrInvalidNumber, "exponent must be followed by a sign or digit")
+	// Valid signed exponential part e.g. e+23, E-123
+	default:
+		if digit, ok := lx.peek(2); !ok || !isDigit(digit) {
+			return lx.errorAt(lx.ahead(2), ErrInvalidNumber, "signed exponent must be followed by a digit")
+		}
+		lx.skip(2)
+	}
+	lx.skipDigits()
+
+	return nil
+}
+
+func (lx *Lexer) skipDigits() {
+	for {
+		for lx.i < len(lx.buf) {
+			if !isDigit(lx.buf[lx.i]) {
+				return
+			}
+			lx.skip(1)
+		}
+		if !lx.fill(1) {
+			return
+		}
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func (lx *Lexer) relaxedNumberToken(start Position) Token {
+	num, err := lx.scanRelaxedNumber()
+	if err != nil {
+		return lx.badNumber(err, start)
+	}
+	tok := NewTokenFromString(NUM, string(lx.buf[lx.token:lx.i]), start, lx.pos())
+	tok.Value = num
+	if num == "" {
+		tok.Value = tok.Literal
+	}
+	return tok
+}
+
+// scanRelaxedNumber moves past a JSON5 number, returning it written as JSON
+// unless that is how it was written already, in which case it returns "".
+// Infinity and NaN have no JSON form and are returned as they are named.
+func (lx *Lexer) scanRelaxedNumber() (string, error) {
+	c, _ := lx.peek(0)
+	plus, sign := c == '+', ""
+	if c == '+' || c == '-' {
+		if _, ok := lx.peek(1); !ok {
+			return "", lx.errorAt(lx.ahead(1), ErrInvalidNumber, "truncated number")
+		}
+		if c == '-' {
+			sign = "-"
+		}
+		lx.skip(1)
+		c, _ = lx.peek(0)
+	}
+
+	next, _ := lx.peek(1)
+	switch {
+	case c == 'I' || c == 'N':
+		pos, word := lx.pos(), lx.mark()
+		lx.skipIdentifier()
+		switch string(lx.since(word)) {
+		case "Infinity":
+			return sign + "Infinity", nil
+		case "NaN":
+			return "NaN", nil
+		}
+		return "", lx.errorAt(pos, ErrInvalidNumber, "%q is not a number", lx.since(0))
+	case c == '0' && (next == 'x' || next == 'X'):
+		return lx.scanHexNumber(sign)
+	case c == '.':
+	case isDigit(c):
+		if c == '0' && isDigit(next) {
+			lx.skip(1)
+			return "", lx.errorAt(lx.pos(), ErrLeadingZero, "numbers cannot lead with zero")
+		}
+	default:
+		return "", lx.errorAt(lx.pos(), ErrInvalidNumber, "sign must be followed by a number")
+	}
+
+	digits := lx.mark()
+	whole := c != '.'
+	lx.skipDigits()
+	point, frac := false, false
+	if c, ok := lx.peek(0); ok && c == '.' {
+		point = true
+		lx.skip(1)
+		fraction := lx.mark()
+		lx.skipDigits()
+		frac = lx.mark() > fraction
+		if !whole && !frac {
+			return "", lx.errorAt(lx.pos(), ErrInvalidNumber, "'.' must be followed by a digit")
+		}
+	}
+	exp := lx.mark()
+	if err := lx.scanExponent(); err != nil {
 		return "", err
 	}
 
-	return buf.String(), nil
+	if !plus && whole && (frac || !point) {
+		return "", nil
+	}
+	mantissa := lx.buf[lx.token+digits : lx.token+exp]
+	if point && !frac {
+		mantissa = mantissa[:len(mantissa)-1]
+	}
+	num := sign
+	if !whole {
+		num += "0"
+	}
+	return num + string(mantissa) + string(lx.since(exp)), nil
 }
 
-func (lx *Lexer) readIntegralPart(buf *strings.Builder) error {
-	next, err := lx.peek(1)
-	if lx.c == '-' {
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return errors.New("truncated integral part")
+// scanHexNumber moves past a 0x number, converting it to decimal.
+func (lx *Lexer) scanHexNumber(sign string) (string, error) {
+	lx.skip(2)
+	digits := lx.mark()
+	for {
+		c, ok := lx.peek(0)
+		if !ok || hexValue(rune(c)) < 0 {
+			break
+		}
+		lx.skip(1)
+	}
+	if lx.mark() == digits {
+		return "", lx.errorAt(lx.pos(), ErrInvalidNumber, "'0x' must be followed by a hex digit")
+	}
+
+	n, _ := new(big.Int).SetString(string(lx.since(digits)), 16)
+	return sign + n.String(), nil
+}
+
+func (lx *Lexer) stringToken(start Position) Token {
+	quote := lx.buf[lx.i]
+	lx.skip(1)
+	raw, str, err := lx.scanString(quote)
+	if err != nil {
+		tok := lx.illegal("bad string", err, start)
+		lx.skipString(quote)
+		return tok
+	}
+	return NewStringToken(raw, str, start, lx.pos())
+}
+
+// scanString moves past the rest of a string, returning both the raw text
+// between the quotes and the string it decodes to. Plain ASCII is skipped
+// over in bulk and only copied if the string turns out to need decoding.
+func (lx *Lexer) scanString(quote byte) (string, string, error) {
+	start := lx.mark()
+	lx.run, lx.unescaped = start, false
+
+	for {
+		for lx.i < len(lx.buf) {
+			c := lx.buf[lx.i]
+			if c < 0x20 || c == quote || c == '\\' || c >= utf8.RuneSelf {
+				break
 			}
-			return fmt.Errorf("readNumber - failed to peek after '-': %w", err)
+			lx.skip(1)
 		}
-		if !unicode.IsDigit(next[0]) {
-			return fmt.Errorf("'-' must be followed by a digit")
+
+		c, ok := lx.peek(0)
+		switch {
+		case !ok:
+			return "", "", lx.errorAt(lx.pos(), ErrUnterminatedString, "unterminated string")
+		case c == quote:
+			raw, str := lx.finishString(start)
+			lx.skip(1)
+			return raw, str, nil
+		case c == '\\':
+			if err := lx.scanEscape(start); err != nil {
+				return "", "", err
+			}
+		case lx.relaxed && (c == '\n' || c == '\r'):
+			return "", "", lx.errorAt(lx.pos(), ErrControlChar, "unescaped line break in string")
+		case c < 0x20 && !lx.relaxed:
+			return "", "", lx.errorAt(lx.pos(), ErrControlChar, "unescaped control character %U in string", c)
+		case c < utf8.RuneSelf:
+			lx.skip(1)
+		default:
+			if err := lx.scanRune(); err != nil {
+				return "", "", err
+			}
 		}
-	} else if lx.c == '0' && err != io.EOF && unicode.IsDigit(next[0]) {
-		return errors.New("numbers cannot lead with zero")
 	}
-	buf.WriteRune(lx.c)
+}
 
-	lx.readDigits(buf)
+// scanRune moves past a character outside ASCII, which must be valid UTF-8.
+func (lx *Lexer) scanRune() error {
+	r, size := lx.decode()
+	switch {
+	case r == utf8.RuneError && size == 1:
+		return lx.badUTF8()
+	case lx.ijson && isNoncharacter(r):
+		return lx.errorAt(lx.pos(), ErrIJSON, "noncharacter %U in string", r)
+	default:
+		lx.i += size
+		lx.col++
+	}
 	return nil
 }
 
-func (lx *Lexer) readFractionalPart(buf *strings.Builder) error {
-	next, err := lx.peek(2)
-	if len(next) == 0 || next[0] != '.' {
-		return nil
+// flushRun copies the text lexed since run to val.
+func (lx *Lexer) flushRun() {
+	lx.val = append(lx.val, lx.since(lx.run)...)
+	lx.run = lx.mark()
+}
+
+func (lx *Lexer) finishString(start int) (string, string) {
+	raw := string(lx.since(start))
+	if !lx.unescaped {
+		return raw, raw
 	}
-	if err != nil {
-		if errors.Is(err, io.EOF) {
-			return errors.New("truncated fractional part")
+
+	lx.flushRun()
+	return raw, string(lx.val)
+}
+
+// skipString moves to the end of a string the lexer has given up on so that
+// lexing can carry on from a sensible place rather than treating the rest of
+// the string as tokens.
+func (lx *Lexer) skipString(quote byte) {
+	for {
+		c, ok := lx.peek(0)
+		if !ok {
+			return
+		}
+		if c == quote || c == '\n' {
+			lx.advance()
+			return
+		}
+		if c == '\\' {
+			lx.skip(1)
+			if _, ok := lx.peek(0); !ok {
+				return
+			}
 		}
-		return fmt.Errorf("readNumber - failed to peek after '.': %w", err)
+		lx.advance()
 	}
-	if !unicode.IsDigit(next[1]) {
-		return fmt.Errorf("'.' must be followed by a digit")
+}
+
+// scanEscape decodes the escape sequence at the next byte onto val.
+func (lx *Lexer) scanEscape(start int) error {
+	if lx.unescaped {
+		lx.flushRun()
+	} else {
+		lx.unescaped = true
+		lx.val = append(lx.val[:0], lx.since(start)...)
 	}
-	lx.readRune()
-	buf.WriteRune(lx.c)
-	lx.readDigits(buf)
 
+	pos := lx.pos()
+	lx.skip(1)
+	if err := lx.decodeEscape(pos); err != nil {
+		return err
+	}
+	lx.run = lx.mark()
 	return nil
 }
 
-func (lx *Lexer) readExponent(buf *strings.Builder) error {
-	next, err := lx.peek(3)
-	length := len(next)
-	switch {
-	// There is no exponential part
-	case length == 0, next[0] != 'e' && next[0] != 'E':
+// decodeEscape decodes the escape sequence starting at pos, the backslash of
+// which has been skipped.
+func (lx *Lexer) decodeEscape(pos Position) error {
+	c, ok := lx.peek(0)
+	if !ok {
+		return lx.errorAt(lx.pos(), ErrUnterminatedString, "unterminated string")
+	}
+
+	switch c {
+	case '"', '\\', '/':
+		lx.val = append(lx.val, c)
+	case 'b':
+		lx.val = append(lx.val, '\b')
+	case 'f':
+		lx.val = append(lx.val, '\f')
+	case 'n':
+		lx.val = append(lx.val, '\n')
+	case 'r':
+		lx.val = append(lx.val, '\r')
+	case 't':
+		lx.val = append(lx.val, '\t')
+	case 'u':
+		lx.skip(1)
+		r, err := lx.scanUnicodeEscape(pos)
+		if err != nil {
+			return err
+		}
+		if lx.ijson && isNoncharacter(r) {
+			return lx.errorAt(pos, ErrIJSON, "noncharacter %U in string", r)
+		}
+		lx.val = utf8.AppendRune(lx.val, r)
 		return nil
-	// We start the exponential part but don't have a value
-	case length == 1:
-		return errors.New("truncated exponent")
-	// Valid, unsigned exponetial part e.g. e2, E42, etc
-	case unicode.IsDigit(next[1]):
-		lx.readRune()
-		buf.WriteRune(lx.c)
-	// The 'e' is followed by an invalid character
-	case next[1] != '+' && next[1] != '-':
-		return errors.New("exponent must be followed by a sign or digit")
-	// We have a signed exponetial part (e.g. e+, e-) but either there is no
-	// numerical value after it
-	case length == 2 || !unicode.IsDigit(next[2]):
-		return errors.New("signed exponent must be followed by a digit")
-	case err != nil && err != io.EOF:
-		return fmt.Errorf(
-			"readExponent - failed to peek after '%c': %w",
-			lx.c,
-			err,
-		)
-	// Valid signed exponential part e.g. e+23, E-123
 	default:
-		lx.readRune()
-		buf.WriteRune(lx.c)
-		lx.readRune()
-		buf.WriteRune(lx.c)
+		if !lx.relaxed {
+			return lx.errorAt(lx.pos(), ErrInvalidEscape, "invalid escape sequence '\\%c'", lx.current())
+		}
+		return lx.decodeRelaxedEscape()
 	}
 
-	lx.readDigits(buf)
+	lx.skip(1)
+	return nil
+}
 
+// decodeRelaxedEscape decodes the escapes JSON5 adds. A backslash before a line
+// break continues the string on the next line and any other character without
+// a meaning of its own stands for itself.
+func (lx *Lexer) decodeRelaxedEscape() error {
+	switch r := lx.current(); r {
+	case 'v':
+		lx.val = append(lx.val, '\v')
+	case '0':
+		if next, _ := lx.peek(1); isDigit(next) {
+			return lx.errorAt(lx.ahead(1), ErrInvalidEscape, "invalid escape sequence '\\0%c'", next)
+		}
+		lx.val = append(lx.val, 0)
+	case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return lx.errorAt(lx.pos(), ErrInvalidEscape, "invalid escape sequence '\\%c'", r)
+	case 'x':
+		lx.skip(1)
+		var r rune
+		for range 2 {
+			if _, ok := lx.peek(0); !ok {
+				return lx.errorAt(lx.pos(), ErrUnterminatedString, "unterminated string")
+			}
+			d := hexValue(lx.current())
+			if d < 0 {
+				return lx.errorAt(lx.pos(), ErrInvalidEscape, "invalid hex escape, %q is not a hex digit", lx.current())
+			}
+			lx.skip(1)
+			r = r<<4 | d
+		}
+		lx.val = utf8.AppendRune(lx.val, r)
+		return nil
+	case '\r':
+		lx.skip(1)
+		if next, _ := lx.peek(0); next == '\n' {
+			lx.advance()
+		}
+		return nil
+	case '\n', '\u2028', '\u2029':
+	default:
+		lx.val = utf8.AppendRune(lx.val, r)
+	}
+
+	lx.advance()
 	return nil
 }
 
-func (lx *Lexer) readDigits(buf *strings.Builder) {
-	next, err := lx.peek(1)
-	for !errors.Is(err, io.EOF) && unicode.IsDigit(next[0]) {
-		lx.readRune()
-		buf.WriteRune(lx.c)
-		next, err = lx.peek(1)
+// scanUnicodeEscape decodes the hex digits of a \u escape starting at pos,
+// combining a surrogate pair if one follows. Unpaired surrogates decode to
+// U+FFFD, unless reading I-JSON which doesn't allow them.
+func (lx *Lexer) scanUnicodeEscape(pos Position) (rune, error) {
+	r, err := lx.scanHex4()
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(r) {
+		return r, nil
+	}
+
+	if r >= 0xdc00 || !lx.lowSurrogateFollows() {
+		if lx.ijson {
+			return 0, lx.errorAt(pos, ErrIJSON, "unpaired surrogate \\u%04x in string", r)
+		}
+		return utf8.RuneError, nil
 	}
+	lx.skip(2)
+	lo, err := lx.scanHex4()
+	if err != nil {
+		return 0, err
+	}
+
+	return utf16.DecodeRune(r, lo), nil
 }
 
-func (lx *Lexer) readString() (string, error) {
-	lx.readRune()
-	var buf strings.Builder
-	esc := false
+// badUTF8 describes the byte sequence the lexer couldn't decode, picking out
+// overlong encodings as they are the usual way of smuggling in characters.
+// I-JSON readers get ErrIJSON as the cause, like its other rules.
+func (lx *Lexer) badUTF8() error {
+	msg := "invalid UTF-8 in string"
+	lx.fill(2)
+	if isOverlong(lx.buf[lx.i:min(lx.i+2, len(lx.buf))]) {
+		msg = "non-shortest form UTF-8 in string"
+	}
+	cause := ErrInvalidUTF8
+	if lx.ijson {
+		cause = ErrIJSON
+	}
+	return lx.errorAt(lx.pos(), cause, "%s", msg)
+}
 
-	for esc || lx.c != '"' {
-		if lx.err != nil {
-			return "", errors.New("unterminated string")
+// isOverlong reports whether b starts a UTF-8 sequence that uses more bytes
+// than the character it encodes needs.
+func isOverlong(b []byte) bool {
+	switch {
+	case len(b) == 0:
+		return false
+	case b[0] == 0xc0 || b[0] == 0xc1:
+		return true
+	case len(b) < 2:
+		return false
+	case b[0] == 0xe0:
+		return b[1] < 0xa0
+	case b[0] == 0xf0:
+		return b[1] < 0x90
+	}
+	return false
+}
+
+// isNoncharacter reports whether Unicode sets r aside for internal use, which
+// means it shouldn't be exchanged.
+func isNoncharacter(r rune) bool {
+	return 0xfdd0 <= r && r <= 0xfdef || r&0xfffe == 0xfffe
+}
+
+func (lx *Lexer) lowSurrogateFollows() bool {
+	if !lx.fill(6) {
+		return false
+	}
+	next := lx.buf[lx.i : lx.i+6]
+	if next[0] != '\\' || next[1] != 'u' {
+		return false
+	}
+	var lo rune
+	for _, c := range next[2:] {
+		d := hexValue(rune(c))
+		if d < 0 {
+			return false
 		}
-		buf.WriteRune(lx.c)
-		esc = !esc && lx.c == '\\'
-		lx.readRune()
+		lo = lo<<4 | d
 	}
 
-	return buf.String(), nil
+	return 0xdc00 <= lo && lo <= 0xdfff
 }
 
-func (lx *Lexer) readIdentifier() string {
-	var buf strings.Builder
-	buf.WriteRune(lx.c)
+func (lx *Lexer) scanHex4() (rune, error) {
+	var r rune
+	for range 4 {
+		if _, ok := lx.peek(0); !ok {
+			return 0, lx.errorAt(lx.pos(), ErrUnterminatedString, "unterminated string")
+		}
+		d := hexValue(lx.current())
+		if d < 0 {
+			return 0, lx.errorAt(lx.pos(), ErrInvalidUnicode, "invalid unicode escape, %q is not a hex digit", lx.current())
+		}
+		lx.skip(1)
+		r = r<<4 | d
+	}
 
-	next, err := lx.peek(1)
-	for !errors.Is(err, io.EOF) && unicode.IsLetter(next[0]) || lx.c == '_' || unicode.IsDigit(lx.c) {
-		lx.readRune()
-		buf.WriteRune(lx.c)
-		next, err = lx.peek(1)
+	return r, nil
+}
+
+func hexValue(c rune) rune {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10
+	}
+	return -1
+}
+
+func (lx *Lexer) identifierToken(start Position) Token {
+	lx.skipIdentifier()
+
+	// Keywords make up most identifiers so avoid copying them.
+	var ident string
+	switch word := lx.buf[lx.token:lx.i]; string(word) {
+	case "null":
+		ident = "null"
+	case "true":
+		ident = "true"
+	case "false":
+		ident = "false"
+	default:
+		ident = string(word)
+	}
+
+	tok := NewTokenFromString(lookupIdentifier(ident), ident, start, lx.pos())
+	if lx.relaxed && (ident == "Infinity" || ident == "NaN") {
+		tok.Type, tok.Value = NUM, ident
+	}
+	return tok
+}
+
+// skipIdentifier moves past an identifier, the first character of which has
+// already been checked.
+func (lx *Lexer) skipIdentifier() {
+	lx.advance()
+	for {
+		if _, ok := lx.peek(0); !ok || !lx.isIdentifierPart(lx.current()) {
+			return
+		}
+		lx.advance()
+	}
+}
+
+func (lx *Lexer) isIdentifierPart(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || lx.relaxed && c == '$'
+}
+
+const snippetWidth = 72
+
+// snippet renders the line containing pos with a caret beneath it. Errors are
+// raised against the token the lexer has just produced, which is always on the
+// current line; anything else gets no snippet.
+func (lx *Lexer) snippet(pos Position) string {
+	col := pos.Col - lx.lineCol
+	if pos.Line != lx.line || col < 0 {
+		return ""
+	}
+
+	line := lx.buf[lx.lineStart:min(len(lx.buf), lx.i+4*snippetWidth)]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	text := []rune(string(bytes.TrimRight(line, "\r")))
+	col = min(col, len(text))
+
+	prefix, suffix := "", ""
+	if start := col - snippetWidth/2; start > 0 {
+		text = text[start:]
+		col -= start
+		prefix = "..."
+	}
+	if len(text) > snippetWidth {
+		text = text[:snippetWidth]
+		suffix = "..."
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "  %s%s%s\n  %s", prefix, string(text), suffix, strings.Repeat(" ", len(prefix)))
+	for _, r := range text[:col] {
+		if r == '\t' {
+			buf.WriteRune('\t')
+		} else {
+			buf.WriteRune(' ')
+		}
 	}
+	buf.WriteRune('^')
 
 	return buf.String()
 }
@@ -1,9 +1,13 @@
 package main_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	jp "github.com/nuchs/ccjp"
 )
@@ -17,22 +21,57 @@ func TestStringTokens(t *testing.T) {
 		{
 			desc: "Empty string",
 			data: "\"\"",
-			want: jp.NewTokenFromString(jp.STRING, "", 1),
+			want: jp.NewStringToken("", "", at(0), at(2)),
 		},
 		{
 			desc: "String",
 			data: "\"bacon egg\"",
-			want: jp.NewTokenFromString(jp.STRING, "bacon egg", 1),
+			want: jp.NewStringToken("bacon egg", "bacon egg", at(0), at(11)),
 		},
 		{
 			desc: "Special characters",
 			data: "\"{}[]():null true false\"",
-			want: jp.NewTokenFromString(jp.STRING, "{}[]():null true false", 1),
+			want: jp.NewStringToken("{}[]():null true false", "{}[]():null true false", at(0), at(24)),
 		},
 		{
 			desc: "Quotes",
 			data: "\"\\\"arrgh\\\"\"",
-			want: jp.NewTokenFromString(jp.STRING, "\\\"arrgh\\\"", 1),
+			want: jp.NewStringToken("\\\"arrgh\\\"", "\"arrgh\"", at(0), at(11)),
+		},
+		{
+			desc: "Simple escapes",
+			data: `"\\\/\b\f\n\r\t"`,
+			want: jp.NewStringToken(`\\\/\b\f\n\r\t`, "\\/\b\f\n\r\t", at(0), at(16)),
+		},
+		{
+			desc: "Unicode escape",
+			data: `"caf\u00e9 \u00C9"`,
+			want: jp.NewStringToken(`caf\u00e9 \u00C9`, "café É", at(0), at(18)),
+		},
+		{
+			desc: "Surrogate pair",
+			data: `"\ud83d\ude00"`,
+			want: jp.NewStringToken(`\ud83d\ude00`, "😀", at(0), at(14)),
+		},
+		{
+			desc: "Unpaired high surrogate",
+			data: `"\ud83dA\u0041"`,
+			want: jp.NewStringToken(`\ud83dA\u0041`, "\uFFFDAA", at(0), at(15)),
+		},
+		{
+			desc: "High surrogate followed by non surrogate escape",
+			data: `"\ud83d\u0041"`,
+			want: jp.NewStringToken(`\ud83d\u0041`, "\uFFFDA", at(0), at(14)),
+		},
+		{
+			desc: "Unpaired low surrogate",
+			data: `"\ude00"`,
+			want: jp.NewStringToken(`\ude00`, "\uFFFD", at(0), at(8)),
+		},
+		{
+			desc: "Multibyte characters",
+			data: `"日本語"`,
+			want: jp.NewStringToken("日本語", "日本語", at(0), jp.Position{Offset: 11, Line: 1, Col: 6}),
 		},
 	}
 	for _, tC := range testCases {
@@ -55,67 +94,67 @@ func TestNumberTokens(t *testing.T) {
 		{
 			desc: "zero",
 			data: "0",
-			want: jp.NewTokenFromString(jp.NUM, "0", 1),
+			want: jp.NewTokenFromString(jp.NUM, "0", at(0), at(1)),
 		},
 		{
 			desc: "Positive int",
 			data: "123",
-			want: jp.NewTokenFromString(jp.NUM, "123", 1),
+			want: jp.NewTokenFromString(jp.NUM, "123", at(0), at(3)),
 		},
 		{
 			desc: "Negative int",
 			data: "-123",
-			want: jp.NewTokenFromString(jp.NUM, "-123", 1),
+			want: jp.NewTokenFromString(jp.NUM, "-123", at(0), at(4)),
 		},
 		{
 			desc: "Positive small float",
 			data: "0.456",
-			want: jp.NewTokenFromString(jp.NUM, "0.456", 1),
+			want: jp.NewTokenFromString(jp.NUM, "0.456", at(0), at(5)),
 		},
 		{
 			desc: "Negative small float",
 			data: "-0.78901",
-			want: jp.NewTokenFromString(jp.NUM, "-0.78901", 1),
+			want: jp.NewTokenFromString(jp.NUM, "-0.78901", at(0), at(8)),
 		},
 		{
 			desc: "Positive big float",
 			data: "123.456",
-			want: jp.NewTokenFromString(jp.NUM, "123.456", 1),
+			want: jp.NewTokenFromString(jp.NUM, "123.456", at(0), at(7)),
 		},
 		{
 			desc: "Negative big float",
 			data: "-999.78901",
-			want: jp.NewTokenFromString(jp.NUM, "-999.78901", 1),
+			want: jp.NewTokenFromString(jp.NUM, "-999.78901", at(0), at(10)),
 		},
 		{
 			desc: "Big e",
 			data: "2E23",
-			want: jp.NewTokenFromString(jp.NUM, "2E23", 1),
+			want: jp.NewTokenFromString(jp.NUM, "2E23", at(0), at(4)),
 		},
 		{
 			desc: "Small e",
 			data: "3e4",
-			want: jp.NewTokenFromString(jp.NUM, "3e4", 1),
+			want: jp.NewTokenFromString(jp.NUM, "3e4", at(0), at(3)),
 		},
 		{
 			desc: "Big positive e",
 			data: "2E+2",
-			want: jp.NewTokenFromString(jp.NUM, "2E+2", 1),
+			want: jp.NewTokenFromString(jp.NUM, "2E+2", at(0), at(4)),
 		},
 		{
 			desc: "Small positive e",
 			data: "2e+2",
-			want: jp.NewTokenFromString(jp.NUM, "2e+2", 1),
+			want: jp.NewTokenFromString(jp.NUM, "2e+2", at(0), at(4)),
 		},
 		{
 			desc: "Big negative e",
 			data: "2E-2",
-			want: jp.NewTokenFromString(jp.NUM, "2E-2", 1),
+			want: jp.NewTokenFromString(jp.NUM, "2E-2", at(0), at(4)),
 		},
 		{
 			desc: "Small negative e",
 			data: "2e-2",
-			want: jp.NewTokenFromString(jp.NUM, "2e-2", 1),
+			want: jp.NewTokenFromString(jp.NUM, "2e-2", at(0), at(4)),
 		},
 	}
 	for _, tC := range testCases {
@@ -200,6 +239,61 @@ func TestBadTokens(t *testing.T) {
 			data: "\"blah",
 			err:  "unterminated string",
 		},
+		{
+			desc: "Unterminated escape",
+			data: `"blah\`,
+			err:  "unterminated string",
+		},
+		{
+			desc: "Unknown escape",
+			data: `"\x41"`,
+			err:  `invalid escape sequence '\x'`,
+		},
+		{
+			desc: "Another unknown escape",
+			data: `"\q"`,
+			err:  `invalid escape sequence '\q'`,
+		},
+		{
+			desc: "Truncated unicode escape",
+			data: `"\u12"`,
+			err:  `invalid unicode escape, '"' is not a hex digit`,
+		},
+		{
+			desc: "Non hex unicode escape",
+			data: `"\u12g4"`,
+			err:  `invalid unicode escape, 'g' is not a hex digit`,
+		},
+		{
+			desc: "Raw newline",
+			data: "\"a\nb\"",
+			err:  "unescaped control character U+000A in string",
+		},
+		{
+			desc: "Raw nul",
+			data: "\"a\x00b\"",
+			err:  "unescaped control character U+0000 in string",
+		},
+		{
+			desc: "Raw unit separator",
+			data: "\"\x1f\"",
+			err:  "unescaped control character U+001F in string",
+		},
+		{
+			desc: "Truncated multi-byte character",
+			data: "\"a\xe2\x82\"",
+			err:  "invalid UTF-8 in string",
+		},
+		{
+			desc: "Truncated multi-byte character after escape",
+			data: "\"\\n\xf0\x9f\x98\"",
+			err:  "invalid UTF-8 in string",
+		},
+		{
+			desc: "Overlong UTF-8",
+			data: "\"\xc0\xaf\"",
+			err:  "non-shortest form UTF-8 in string",
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
@@ -215,6 +309,35 @@ func TestBadTokens(t *testing.T) {
 	}
 }
 
+func TestBadTokenCauses(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		want error
+	}{
+		{desc: "leading zero", data: "0123", want: jp.ErrLeadingZero},
+		{desc: "truncated exponent", data: "1e", want: jp.ErrInvalidNumber},
+		{desc: "unterminated string", data: `"abc`, want: jp.ErrUnterminatedString},
+		{desc: "invalid escape", data: `"\a"`, want: jp.ErrInvalidEscape},
+		{desc: "invalid unicode", data: `"\u12"`, want: jp.ErrInvalidUnicode},
+		{desc: "control character", data: "\"\x01\"", want: jp.ErrControlChar},
+		{desc: "invalid UTF-8", data: "\"a\xe2\x82\"", want: jp.ErrInvalidUTF8},
+		{desc: "unrecognised", data: "#", want: jp.ErrUnrecognisedToken},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			lx := jp.NewLexer(strings.NewReader(tC.data))
+			got := lx.NextToken()
+			if got.Type != jp.ILLEGAL {
+				t.Fatalf("Wrong token type: got %q, want \"ILLEGAL\"", got.Type)
+			}
+			if !errors.Is(got.Err, tC.want) {
+				t.Fatalf("Wrong cause: got %v, want %v", got.Err, tC.want)
+			}
+		})
+	}
+}
+
 func TestSimpleTokens(t *testing.T) {
 	testCases := []struct {
 		desc string
@@ -233,6 +356,9 @@ func TestSimpleTokens(t *testing.T) {
 		{desc: "True", data: "true", want: []jp.TokenType{jp.TRUE, jp.EOF}},
 		{desc: "False", data: "false", want: []jp.TokenType{jp.FALSE, jp.EOF}},
 		{desc: "Skip Whitespace", data: " \n\r\t", want: []jp.TokenType{jp.EOF}},
+		{desc: "Multi-byte after keyword", data: "true→", want: []jp.TokenType{jp.TRUE, jp.ILLEGAL}},
+		{desc: "Multi-byte after number", data: "[1…]", want: []jp.TokenType{jp.LBRCKT, jp.NUM, jp.ILLEGAL}},
+		{desc: "Multi-byte identifier", data: "café null", want: []jp.TokenType{jp.IDENT, jp.NULL, jp.EOF}},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
@@ -245,6 +371,256 @@ func TestSimpleTokens(t *testing.T) {
 	}
 }
 
+func TestTokenPositions(t *testing.T) {
+	data := "{\n  \"ключ\": [1, true],\r\n\t\"k\" : null\n}"
+	want := []struct {
+		tt         jp.TokenType
+		start, end jp.Position
+	}{
+		{jp.LBRACE, jp.Position{Offset: 0, Line: 1, Col: 1}, jp.Position{Offset: 1, Line: 1, Col: 2}},
+		{jp.STRING, jp.Position{Offset: 4, Line: 2, Col: 3}, jp.Position{Offset: 14, Line: 2, Col: 9}},
+		{jp.COLON, jp.Position{Offset: 14, Line: 2, Col: 9}, jp.Position{Offset: 15, Line: 2, Col: 10}},
+		{jp.LBRCKT, jp.Position{Offset: 16, Line: 2, Col: 11}, jp.Position{Offset: 17, Line: 2, Col: 12}},
+		{jp.NUM, jp.Position{Offset: 17, Line: 2, Col: 12}, jp.Position{Offset: 18, Line: 2, Col: 13}},
+		{jp.COMMA, jp.Position{Offset: 18, Line: 2, Col: 13}, jp.Position{Offset: 19, Line: 2, Col: 14}},
+		{jp.TRUE, jp.Position{Offset: 20, Line: 2, Col: 15}, jp.Position{Offset: 24, Line: 2, Col: 19}},
+		{jp.RBRCKT, jp.Position{Offset: 24, Line: 2, Col: 19}, jp.Position{Offset: 25, Line: 2, Col: 20}},
+		{jp.COMMA, jp.Position{Offset: 25, Line: 2, Col: 20}, jp.Position{Offset: 26, Line: 2, Col: 21}},
+		{jp.STRING, jp.Position{Offset: 29, Line: 3, Col: 2}, jp.Position{Offset: 32, Line: 3, Col: 5}},
+		{jp.COLON, jp.Position{Offset: 33, Line: 3, Col: 6}, jp.Position{Offset: 34, Line: 3, Col: 7}},
+		{jp.NULL, jp.Position{Offset: 35, Line: 3, Col: 8}, jp.Position{Offset: 39, Line: 3, Col: 12}},
+		{jp.RBRACE, jp.Position{Offset: 40, Line: 4, Col: 1}, jp.Position{Offset: 41, Line: 4, Col: 2}},
+		{jp.EOF, jp.Position{Offset: 41, Line: 4, Col: 2}, jp.Position{Offset: 41, Line: 4, Col: 2}},
+	}
+
+	lx := jp.NewLexer(strings.NewReader(data))
+	for i, w := range want {
+		got := lx.NextToken()
+		if got.Type != w.tt || got.Start != w.start || got.End != w.end {
+			t.Fatalf(
+				"Bad token %d: got %s %+v-%+v, want %s %+v-%+v",
+				i, got.Type, got.Start, got.End, w.tt, w.start, w.end,
+			)
+		}
+	}
+}
+
+func TestBadTokenPositions(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		want jp.Position
+	}{
+		{desc: "unrecognised", data: "  @", want: at(2)},
+		{desc: "leading zero", data: "[0123", want: at(2)},
+		{desc: "dash non number", data: "-a", want: at(1)},
+		{desc: "truncated dot", data: "12.", want: at(3)},
+		{desc: "signed exponent", data: "1e+x", want: at(3)},
+		{desc: "bad escape", data: `"ab\q"`, want: at(4)},
+		{desc: "unterminated string", data: `"abc`, want: at(4)},
+		{desc: "truncated multi-byte character", data: "\"é\xe2\x82\"", want: jp.Position{Offset: 3, Line: 1, Col: 3}},
+		{
+			desc: "control character on second line",
+			data: "\n\"a\tb\"",
+			want: jp.Position{Offset: 3, Line: 2, Col: 3},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			lx := jp.NewLexer(strings.NewReader(tC.data))
+			got := lx.NextToken()
+			if got.Type == jp.LBRCKT {
+				got = lx.NextToken()
+			}
+			if got.Type != jp.ILLEGAL {
+				t.Fatalf("Wrong token type: got %q, want \"ILLEGAL\"", got.Type)
+			}
+			if got.End != tC.want {
+				t.Fatalf("Wrong position: got %+v, want %+v", got.End, tC.want)
+			}
+		})
+	}
+}
+
+func TestRelaxedTokens(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		want []jp.Token
+	}{
+		{
+			desc: "comments",
+			data: "// line\n/* block\n */ 1 /**/",
+			want: []jp.Token{{
+				Type:    jp.NUM,
+				Literal: "1",
+				Value:   "1",
+				Start:   jp.Position{Offset: 21, Line: 3, Col: 5},
+				End:     jp.Position{Offset: 22, Line: 3, Col: 6},
+			}},
+		},
+		{
+			desc: "single quoted string",
+			data: `'say "hi"\''`,
+			want: []jp.Token{jp.NewStringToken(`say "hi"\'`, `say "hi"'`, at(0), at(12))},
+		},
+		{
+			desc: "relaxed escapes",
+			data: `"\x41\v\0\q"`,
+			want: []jp.Token{jp.NewStringToken(`\x41\v\0\q`, "A\v\x00q", at(0), at(12))},
+		},
+		{
+			desc: "line continuation",
+			data: "'a\\\r\nb'",
+			want: []jp.Token{
+				jp.NewStringToken("a\\\r\nb", "ab", at(0), jp.Position{Offset: 7, Line: 2, Col: 3}),
+			},
+		},
+		{
+			desc: "identifier",
+			data: "$ok_1",
+			want: []jp.Token{jp.NewTokenFromString(jp.IDENT, "$ok_1", at(0), at(5))},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			lx := jp.NewRelaxedLexer(strings.NewReader(tC.data))
+			for _, want := range tC.want {
+				if got := lx.NextToken(); !reflect.DeepEqual(got, want) {
+					t.Fatalf("Bad token: got %+v, want %+v", got, want)
+				}
+			}
+			if got := lx.NextToken(); got.Type != jp.EOF {
+				t.Fatalf("Bad token: got %+v, want EOF", got)
+			}
+		})
+	}
+}
+
+func TestRelaxedLineCommentEnds(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+	}{
+		{desc: "line feed", data: "// c\n1"},
+		{desc: "carriage return", data: "// c\r1"},
+		{desc: "line separator", data: "// c\u20281"},
+		{desc: "paragraph separator", data: "// c\u20291"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			lx := jp.NewRelaxedLexer(strings.NewReader(tC.data))
+			if got := lx.NextToken(); got.Type != jp.NUM || got.Literal != "1" {
+				t.Fatalf("Bad token: got %+v, want NUM(1)", got)
+			}
+			if got := lx.NextToken(); got.Type != jp.EOF {
+				t.Fatalf("Bad token: got %+v, want EOF", got)
+			}
+		})
+	}
+}
+
+func TestRelaxedNumberTokens(t *testing.T) {
+	testCases := []struct {
+		data string
+		want string
+	}{
+		{data: "12", want: "12"},
+		{data: "+1", want: "1"},
+		{data: ".5", want: "0.5"},
+		{data: "-.5e2", want: "-0.5e2"},
+		{data: "5.", want: "5"},
+		{data: "5.e-3", want: "5e-3"},
+		{data: "0x1F", want: "31"},
+		{data: "-0XfF", want: "-255"},
+		{data: "0x10000000000000000", want: "18446744073709551616"},
+		{data: "Infinity", want: "Infinity"},
+		{data: "+Infinity", want: "Infinity"},
+		{data: "-Infinity", want: "-Infinity"},
+		{data: "-NaN", want: "NaN"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.data, func(t *testing.T) {
+			lx := jp.NewRelaxedLexer(strings.NewReader(tC.data))
+			got := lx.NextToken()
+			if got.Type != jp.NUM || got.Literal != tC.data || got.Value != tC.want {
+				t.Fatalf("Bad token: got %s %q %q, want NUM %q %q", got.Type, got.Literal, got.Value, tC.data, tC.want)
+			}
+		})
+	}
+}
+
+func TestBadRelaxedTokens(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		data  string
+		err   string
+		cause error
+	}{
+		{desc: "lone slash", data: "/ 1", err: "unrecognised token: /", cause: jp.ErrUnrecognisedToken},
+		{desc: "unterminated comment", data: "/* 1 *", err: "unterminated comment", cause: jp.ErrUnterminatedComment},
+		{desc: "raw newline", data: "'a\nb'", err: "unescaped line break in string", cause: jp.ErrControlChar},
+		{desc: "octal escape", data: `'\01'`, err: `invalid escape sequence '\01'`, cause: jp.ErrInvalidEscape},
+		{desc: "digit escape", data: `'\7'`, err: `invalid escape sequence '\7'`, cause: jp.ErrInvalidEscape},
+		{desc: "bad hex escape", data: `'\x4g'`, err: `invalid hex escape, 'g' is not a hex digit`, cause: jp.ErrInvalidEscape},
+		{desc: "leading zero", data: "+01", err: "numbers cannot lead with zero", cause: jp.ErrLeadingZero},
+		{desc: "bare dot", data: ".", err: "'.' must be followed by a digit", cause: jp.ErrInvalidNumber},
+		{desc: "empty hex", data: "0x", err: "'0x' must be followed by a hex digit", cause: jp.ErrInvalidNumber},
+		{desc: "sign alone", data: "+", err: "truncated number", cause: jp.ErrInvalidNumber},
+		{desc: "signed word", data: "-Inf", err: `"-Inf" is not a number`, cause: jp.ErrInvalidNumber},
+		{desc: "signed string", data: "+'1'", err: "sign must be followed by a number", cause: jp.ErrInvalidNumber},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			lx := jp.NewRelaxedLexer(strings.NewReader(tC.data))
+			got := lx.NextToken()
+			if got.Type != jp.ILLEGAL {
+				t.Fatalf("Wrong token type: got %q, want \"ILLEGAL\"", got.Type)
+			}
+			if !strings.HasSuffix(got.Literal, tC.err) {
+				t.Fatalf("Wrong error: got %q, want %q", got.Literal, tC.err)
+			}
+			if !errors.Is(got.Err, tC.cause) {
+				t.Fatalf("Wrong cause: got %v, want %v", got.Err, tC.cause)
+			}
+		})
+	}
+}
+
+func TestTokensAcrossReads(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		data    string
+		relaxed bool
+	}{
+		{desc: "escapes", data: `{"k\u00e9y": ["a\tb", "\ud83d\ude00", -1.5e+3]}`},
+		{desc: "multi-byte", data: "[\"héllo wörld\", \"😀\", null]\n[true]"},
+		{desc: "invalid UTF-8", data: "\"a\xffb\\n\xc0\""},
+		{desc: "errors", data: "[01, \"a\\q\", 1e+, @]"},
+		{desc: "relaxed", data: "// c\n{a: 'x\\\ny', b: +.5, c: 0x1F, /* d */ e: -Infinity}", relaxed: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			newLexer := jp.NewLexer
+			if tC.relaxed {
+				newLexer = jp.NewRelaxedLexer
+			}
+			whole := newLexer(strings.NewReader(tC.data))
+			split := newLexer(iotest.OneByteReader(strings.NewReader(tC.data)))
+			for {
+				want := whole.NextToken()
+				got := split.NextToken()
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("Bad token: got %+v, want %+v", got, want)
+				}
+				if want.Type == jp.EOF {
+					break
+				}
+			}
+		})
+	}
+}
+
 func readAll(lx *jp.Lexer) []jp.TokenType {
 	tt := []jp.TokenType{}
 
@@ -258,3 +634,56 @@ func readAll(lx *jp.Lexer) []jp.TokenType {
 
 	return tt
 }
+
+// at is the position of the nth byte of a single line of ASCII input.
+func at(n int) jp.Position {
+	return jp.Position{Offset: n, Line: 1, Col: n + 1}
+}
+
+// benchmarkDocument builds an array of records of roughly size bytes, mixing
+// the kinds of tokens found in typical documents.
+func benchmarkDocument(size int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("[\n")
+	for i := 0; buf.Len() < size; i++ {
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		fmt.Fprintf(&buf,
+			`  {"id": %d, "name": "user %d", "score": %d.%03de-2, "active": %t, "tags": ["a\tb", "café", "\u00e9\ud83d\ude00"], "manager": null}`,
+			i, i, i%1000, i%997, i%2 == 0,
+		)
+	}
+	buf.WriteString("\n]\n")
+	return buf.Bytes()
+}
+
+func BenchmarkLexer(b *testing.B) {
+	doc := benchmarkDocument(4 << 20)
+	b.SetBytes(int64(len(doc)))
+	b.ReportAllocs()
+	for b.Loop() {
+		lx := jp.NewLexer(bytes.NewReader(doc))
+		for {
+			tok := lx.NextToken()
+			if tok.Type == jp.ILLEGAL {
+				b.Fatalf("Unexpected error: %s", tok.Literal)
+			}
+			if tok.Type == jp.EOF {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	doc := benchmarkDocument(4 << 20)
+	b.SetBytes(int64(len(doc)))
+	b.ReportAllocs()
+	for b.Loop() {
+		p := jp.NewParser(bytes.NewReader(doc))
+		if _, err := p.Parse(); err != nil {
+			b.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Record is one document read from a stream of them. Index counts from zero
+// and Line is where the document starts. Err holds whatever was wrong with
+// it, in which case Value is whatever could be salvaged, and Warnings any
+// problems that weren't bad enough to reject it.
+type Record struct {
+	Index    int
+	Line     int
+	Value    Value
+	Err      error
+	Warnings ErrorList
+}
+
+// ReadLines parses src as JSON Lines, handing each line to fn as a document of
+// its own. Blank lines are skipped. A bad record doesn't stop the rest of the
+// stream being read and the positions in its errors are relative to the whole
+// stream rather than the line. Reading stops at the first error from src or
+// fn, which is returned.
+func ReadLines(src io.Reader, opts Options, fn func(Record) error) error {
+	in := bufio.NewReader(src)
+	offset, index := 0, 0
+	for n := 1; ; n++ {
+		line, err := in.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		// Leave the line break off so that errors at the end of the record
+		// point there rather than at the start of the next line.
+		if record := bytes.TrimRight(line, "\r\n"); len(bytes.TrimSpace(record)) > 0 {
+			p := NewParserWithOptions(bytes.NewReader(record), opts)
+			doc, perr := p.Parse()
+			shiftErrors(perr, n, offset)
+			warnings := p.Warnings()
+			shiftErrors(warnings, n, offset)
+			rec := Record{Index: index, Line: n, Value: doc, Err: perr, Warnings: warnings}
+			if ferr := fn(rec); ferr != nil {
+				return ferr
+			}
+			index++
+		}
+
+		offset += len(line)
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// shiftErrors moves the positions of errors found on a line on their own to
+// where that line is in the stream, along with those of the token found and
+// of the first definition of a duplicate key.
+func shiftErrors(err error, line, offset int) {
+	var errs ErrorList
+	var single *ParseError
+	switch {
+	case errors.As(err, &errs):
+	case errors.As(err, &single):
+		errs = ErrorList{single}
+	}
+
+	shift := func(pos *Position) {
+		if pos.Line > 0 {
+			pos.Line += line - 1
+			pos.Offset += offset
+		}
+	}
+	for _, e := range errs {
+		shift(&e.Pos)
+		shift(&e.Found.Start)
+		shift(&e.Found.End)
+
+		var dup *DuplicateKeyError
+		var lex *lexError
+		switch {
+		case errors.As(e.Cause, &dup):
+			shift(&dup.First)
+		case errors.As(e.Cause, &lex):
+			shift(&lex.pos)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestReadLines(t *testing.T) {
+	data := "{\"a\": 1}\n\n  \n[1, 2\r\n\"ok\"\r\n{\"b\" 2}\ntrue\n{\"k\": 1, \"k\": 2}"
+	want := []struct {
+		line  int
+		doc   string
+		errs  []jp.Position
+		first jp.Position
+	}{
+		{line: 1, doc: `{"a":1}`},
+		{line: 4, errs: []jp.Position{{Offset: 18, Line: 4, Col: 6}}},
+		{line: 5, doc: `"ok"`},
+		{line: 6, errs: []jp.Position{{Offset: 31, Line: 6, Col: 6}}},
+		{line: 7, doc: `true`},
+		{
+			line:  8,
+			errs:  []jp.Position{{Offset: 48, Line: 8, Col: 10}},
+			first: jp.Position{Offset: 40, Line: 8, Col: 2},
+		},
+	}
+
+	var got []jp.Record
+	err := jp.ReadLines(strings.NewReader(data), jp.Options{Duplicates: jp.RejectDuplicates}, func(rec jp.Record) error {
+		got = append(got, rec)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Bad record count: got %d, want %d", len(got), len(want))
+	}
+
+	for i, w := range want {
+		rec := got[i]
+		if rec.Line != w.line {
+			t.Fatalf("Bad line for record %d: got %d, want %d", i, rec.Line, w.line)
+		}
+		if w.errs == nil {
+			if rec.Err != nil {
+				t.Fatalf("Unexpected error on line %d: %v", rec.Line, rec.Err)
+			}
+			if doc := jp.FormatString(rec.Value, jp.FormatOptions{}); doc != w.doc {
+				t.Fatalf("Bad document on line %d: got %s, want %s", rec.Line, doc, w.doc)
+			}
+			continue
+		}
+
+		var perr *jp.ParseError
+		if !errors.As(rec.Err, &perr) {
+			t.Fatalf("Bad error on line %d: got %v, want a ParseError", rec.Line, rec.Err)
+		}
+		if perr.Pos != w.errs[0] {
+			t.Fatalf("Bad position on line %d: got %+v, want %+v", rec.Line, perr.Pos, w.errs[0])
+		}
+		if perr.Found.Start.Line != rec.Line {
+			t.Fatalf("Bad token position on line %d: got %+v", rec.Line, perr.Found.Start)
+		}
+		var dup *jp.DuplicateKeyError
+		if errors.As(perr, &dup) && dup.First != w.first {
+			t.Fatalf("Bad first definition on line %d: got %+v, want %+v", rec.Line, dup.First, w.first)
+		}
+	}
+}
+
+func TestReadLinesRecover(t *testing.T) {
+	data := "1\n{\"a\" 1, \"b\": }\n"
+	var errs jp.ErrorList
+	err := jp.ReadLines(strings.NewReader(data), jp.Options{Recover: true}, func(rec jp.Record) error {
+		if rec.Err != nil && !errors.As(rec.Err, &errs) {
+			t.Fatalf("Bad error: got %T, want ErrorList", rec.Err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []jp.Position{{Offset: 7, Line: 2, Col: 6}, {Offset: 15, Line: 2, Col: 14}}
+	if len(errs) != len(want) {
+		t.Fatalf("Bad error count: got %d, want %d", len(errs), len(want))
+	}
+	for i, e := range errs {
+		if e.Pos != want[i] {
+			t.Fatalf("Bad position for error %d: got %+v, want %+v", i, e.Pos, want[i])
+		}
+	}
+}
+
+func TestReadLinesStops(t *testing.T) {
+	stop := errors.New("stop")
+	count := 0
+	err := jp.ReadLines(strings.NewReader("1\n2\n3\n"), jp.Options{}, func(rec jp.Record) error {
+		count++
+		if rec.Line == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || count != 2 {
+		t.Fatalf("Bad result: got %v after %d records, want %v after 2", err, count, stop)
+	}
+}
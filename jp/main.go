@@ -3,47 +3,636 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 )
 
+// command runs against one source, reporting whether it was happy with it.
+type command func(spec Spec, name string, src io.Reader) bool
+
 func main() {
-	src, err := openSource()
+	spec, err := LoadSpec(os.Args[1:])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load json: %s\n", err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+
+	if spec.Diff {
+		os.Exit(diff(spec))
+	}
+	if spec.Merge {
+		os.Exit(merge(spec))
+	}
+	if spec.Infer {
+		os.Exit(infer(spec))
+	}
+
+	cmd := validate
+	switch {
+	case spec.Format:
+		cmd = format
+	case spec.Minify:
+		cmd = minify
+	case spec.Canonical, spec.Digest:
+		cmd = canonical
+	case spec.Lookup:
+		cmd = lookup
+	case spec.Select:
+		cmd = query
+	case spec.Patch != "":
+		cmd = applyPatch
+	case spec.MergePatch != "":
+		cmd = applyMergePatch
+	case spec.Schema != "":
+		cmd = checkSchema
+	case spec.NDJSON:
+		cmd = validateLines
+	case spec.Sequence:
+		cmd = validateSequence
+	}
+
+	status := 0
+	for _, name := range spec.Sources {
+		if !runSource(spec, name, cmd) {
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func runSource(spec Spec, name string, cmd command) bool {
+	src, err := openSource(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load json: %s\n", err)
+		return false
+	}
 	defer closeSource(src)
 
-	p := NewParser(src)
-	if err := p.Parse(); err != nil {
-		fmt.Printf("Bad JSON: %s\n", err)
-		os.Exit(1)
+	return cmd(spec, name, src)
+}
+
+func validate(spec Spec, name string, src io.Reader) bool {
+	prefix := ""
+	if len(spec.Sources) > 1 {
+		prefix = name + ": "
+	}
+
+	p := NewParserWithOptions(src, spec.ParseOptions())
+	_, err := p.Parse()
+	reportWarnings(os.Stdout, prefix, p.Warnings())
+	if err != nil {
+		reportErrors(prefix, err)
+		return false
 	}
 
-	fmt.Println("Good JSON")
+	fmt.Printf("%sGood JSON\n", prefix)
+	return true
 }
 
-func openSource() (io.ReadCloser, error) {
-	info, err := os.Stdin.Stat()
+// validateLines checks every record in a JSON Lines source, finishing with a
+// count of how many were good and bad.
+func validateLines(spec Spec, name string, src io.Reader) bool {
+	t := newTally(spec, name)
+	err := ReadLines(src, spec.ParseOptions(), func(rec Record) error {
+		t.add(rec)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to stat stdin: %w", err)
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", name, err)
+		return false
 	}
-	if (info.Mode() & os.ModeCharDevice) == 0 {
-		return os.Stdin, nil
+	return t.report()
+}
+
+// validateSequence checks every value in a source holding a sequence of them,
+// finishing with a count of how many were good and bad.
+func validateSequence(spec Spec, name string, src io.Reader) bool {
+	t := newTally(spec, name)
+	p := NewParserWithOptions(src, spec.ParseOptions())
+	for {
+		rec, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", name, err)
+			return false
+		}
+		t.add(rec)
 	}
+	return t.report()
+}
 
-	if len(os.Args) < 2 {
-		return nil, errors.New("no json source provided")
+// tally keeps count of the good and bad records in a source, reporting the
+// problems with the bad ones as it goes.
+type tally struct {
+	prefix    string
+	good, bad int
+}
+
+func newTally(spec Spec, name string) *tally {
+	t := &tally{}
+	if len(spec.Sources) > 1 {
+		t.prefix = name + ": "
+	}
+	return t
+}
+
+func (t *tally) add(rec Record) {
+	reportWarnings(os.Stdout, t.prefix, rec.Warnings)
+	if rec.Err != nil {
+		reportErrors(t.prefix, rec.Err)
+		t.bad++
+		return
+	}
+	t.good++
+}
+
+func (t *tally) report() bool {
+	fmt.Printf("%srecords: %d good, %d bad\n", t.prefix, t.good, t.bad)
+	return t.bad == 0
+}
+
+func format(spec Spec, name string, src io.Reader) bool {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", name, err)
+		return false
+	}
+
+	var out bytes.Buffer
+	ok := eachDocument(name, bytes.NewReader(data), spec.ParseOptions(), func(doc Value, _ Positions) bool {
+		if err := Format(&out, doc, spec.FormatOptions()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to format %s: %s\n", name, err)
+			return false
+		}
+		out.WriteByte('\n')
+		return true
+	})
+	if !ok {
+		return false
+	}
+
+	if spec.Check {
+		if !bytes.Equal(data, out.Bytes()) {
+			fmt.Printf("%s is not formatted\n", name)
+			return false
+		}
+		return true
+	}
+
+	os.Stdout.Write(out.Bytes())
+	return true
+}
+
+// minify copies the document token by token, unless it is JSON5 in which case
+// it has to be rewritten as JSON. Each value of a sequence goes on a line of
+// its own.
+func minify(spec Spec, name string, src io.Reader) bool {
+	if spec.Relaxed {
+		return eachDocument(name, src, spec.ParseOptions(), func(doc Value, _ Positions) bool {
+			if err := Format(os.Stdout, doc, FormatOptions{}); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to minify %s: %s\n", name, err)
+				return false
+			}
+			fmt.Println()
+			return true
+		})
+	}
+
+	copyMinified := Minify
+	if spec.Sequence {
+		copyMinified = MinifySequence
+	}
+	if err := copyMinified(os.Stdout, src); err != nil {
+		fmt.Println()
+		reportErrors(name+": ", err)
+		return false
+	}
+
+	fmt.Println()
+	return true
+}
+
+func canonical(spec Spec, name string, src io.Reader) bool {
+	return eachDocument(name, src, spec.ParseOptions(), func(doc Value, _ Positions) bool {
+		return canonicalize(spec, name, doc)
+	})
+}
+
+func canonicalize(spec Spec, name string, doc Value) bool {
+	if spec.Digest {
+		sum, err := CanonicalDigest(doc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to canonicalize %s: %s\n", name, err)
+			return false
+		}
+		fmt.Printf("%x  %s\n", sum, name)
+		return true
+	}
+
+	if err := Canonicalize(os.Stdout, doc); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to canonicalize %s: %s\n", name, err)
+		return false
+	}
+	fmt.Println()
+	return true
+}
+
+func lookup(spec Spec, name string, src io.Reader) bool {
+	ptr, err := ParsePointer(spec.Pointer)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	return eachDocument(name, src, spec.ParseOptions(), func(doc Value, _ Positions) bool {
+		v, err := ptr.Resolve(doc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			return false
+		}
+		return writeValue(spec, v)
+	})
+}
+
+// query prints each match on a line of its own, as compact JSON.
+func query(spec Spec, name string, src io.Reader) bool {
+	q, err := ParseQuery(spec.Query)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	out := bufio.NewWriter(os.Stdout)
+	var line bytes.Buffer
+	ok := eachDocument(name, src, spec.ParseOptions(), func(doc Value, _ Positions) bool {
+		for _, n := range q.Select(doc) {
+			line.Reset()
+			if spec.Paths {
+				line.Write(appendString(nil, n.Path.Normalized()))
+			} else if err := Format(&line, n.Value, FormatOptions{}); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+				return false
+			}
+			line.WriteByte('\n')
+			out.Write(line.Bytes())
+		}
+		return true
+	})
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err)
+		return false
+	}
+	return ok
+}
+
+// applyPatch patches the document, only writing it out if every operation
+// succeeded.
+func applyPatch(spec Spec, name string, src io.Reader) bool {
+	p, ok := loadPatch(spec, spec.Patch)
+	if !ok {
+		return false
+	}
+	return eachDocument(name, src, spec.ParseOptions(), func(doc Value, _ Positions) bool {
+		doc, err := p.Apply(doc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: failed to apply %s: %s\n", name, spec.Patch, err)
+			return false
+		}
+		if spec.Write {
+			return writeFile(spec, name, doc)
+		}
+		return writeValue(spec, doc)
+	})
+}
+
+func loadPatch(spec Spec, name string) (Patch, bool) {
+	doc, ok := loadDocument(spec, name)
+	if !ok {
+		return nil, false
+	}
+	p, err := ParsePatch(doc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return nil, false
+	}
+	return p, true
+}
+
+func applyMergePatch(spec Spec, name string, src io.Reader) bool {
+	p, ok := loadDocument(spec, spec.MergePatch)
+	if !ok {
+		return false
+	}
+	return eachDocument(name, src, spec.ParseOptions(), func(doc Value, _ Positions) bool {
+		doc = MergePatch(doc, p)
+		if spec.Write {
+			return writeFile(spec, name, doc)
+		}
+		return writeValue(spec, doc)
+	})
+}
+
+// checkSchema validates the document against the schema, listing every way
+// in which it doesn't match.
+func checkSchema(spec Spec, name string, src io.Reader) bool {
+	prefix := ""
+	if len(spec.Sources) > 1 {
+		prefix = name + ": "
+	}
+
+	doc, ok := loadDocument(spec, spec.Schema)
+	if !ok {
+		return false
+	}
+	schema, err := CompileSchema(doc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", spec.Schema, err)
+		return false
+	}
+
+	opts := spec.ParseOptions()
+	opts.TrackPositions = true
+	return eachDocument(name, src, opts, func(inst Value, pos Positions) bool {
+		err := schema.Validate(inst, pos)
+		var errs ValidationErrors
+		if errors.As(err, &errs) {
+			for _, err := range errs {
+				fmt.Printf("%sSchema violation: %s\n", prefix, err)
+			}
+			return false
+		}
+
+		fmt.Printf("%sGood JSON\n", prefix)
+		return true
+	})
+}
+
+// merge layers the sources on top of one another, exiting with 1 if they
+// couldn't be merged.
+func merge(spec Spec) int {
+	layers := make([]Layer, 0, len(spec.Sources))
+	for _, name := range spec.Sources {
+		doc, ok := loadDocument(spec, name)
+		if !ok {
+			return 1
+		}
+		layers = append(layers, Layer{Name: name, Doc: doc})
+	}
+
+	opts := MergeOptions{Arrays: ArrayStrategy(spec.Arrays), ArrayKey: spec.MergeKey}
+	doc, origins, err := Merge(layers, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to merge: %s\n", err)
+		return 1
 	}
-	f, err := os.Open(os.Args[1])
+
+	if !spec.Blame {
+		if !writeValue(spec, doc) {
+			return 1
+		}
+		return 0
+	}
+	for _, o := range origins {
+		fmt.Println(o)
+	}
+	return 0
+}
+
+// infer prints a schema describing every sample in the sources, exiting with
+// 1 if any of them couldn't be read.
+func infer(spec Spec) int {
+	var samples []Value
+	for _, name := range spec.Sources {
+		var docs []Value
+		var ok bool
+		if spec.NDJSON {
+			docs, ok = loadLines(spec, name)
+		} else {
+			var doc Value
+			doc, ok = loadDocument(spec, name)
+			docs = []Value{doc}
+		}
+		if !ok {
+			return 1
+		}
+		samples = append(samples, docs...)
+	}
+
+	if !writeValue(spec, InferSchema(samples, InferOptions{MaxEnum: spec.MaxEnum})) {
+		return 1
+	}
+	return 0
+}
+
+// loadLines reads a source holding one document per line.
+func loadLines(spec Spec, name string) ([]Value, bool) {
+	src, err := openSource(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file %q: %w", os.Args[1], err)
+		fmt.Fprintf(os.Stderr, "Failed to load json: %s\n", err)
+		return nil, false
+	}
+	defer closeSource(src)
+
+	var docs []Value
+	ok := true
+	err = ReadLines(src, spec.ParseOptions(), func(rec Record) error {
+		if rec.Err != nil {
+			reportErrors(name+": ", rec.Err)
+			ok = false
+		}
+		docs = append(docs, rec.Value)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", name, err)
+		return nil, false
+	}
+	return docs, ok
+}
+
+// loadDocument opens, reads and closes a whole document.
+func loadDocument(spec Spec, name string) (Value, bool) {
+	src, err := openSource(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load json: %s\n", err)
+		return nil, false
+	}
+	defer closeSource(src)
+
+	return parseSource(spec, name, src)
+}
+
+// writeFile replaces the file called name with v. The new contents are
+// written alongside and renamed into place so the file is never left half
+// written.
+func writeFile(spec Spec, name string, v Value) bool {
+	var out bytes.Buffer
+	if err := Format(&out, v, spec.FormatOptions()); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to format %s: %s\n", name, err)
+		return false
+	}
+	out.WriteByte('\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".ccjp-*")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %s\n", name, err)
+		return false
+	}
+	_, err = tmp.Write(out.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if info, statErr := os.Stat(name); statErr == nil {
+			err = os.Chmod(tmp.Name(), info.Mode().Perm())
+		}
 	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %s\n", name, err)
+		return false
+	}
+	return true
+}
+
+// diff compares the two sources, exiting like diff(1) does: 0 if they're the
+// same, 1 if they differ and 2 if they couldn't be compared.
+func diff(spec Spec) int {
+	var docs [2]Value
+	for i, name := range spec.Sources {
+		doc, ok := loadDocument(spec, name)
+		if !ok {
+			return 2
+		}
+		docs[i] = doc
+	}
+
+	changes := Diff(docs[0], docs[1], spec.DiffOptions())
+	if spec.DiffPatch {
+		if !writeValue(spec, DiffPatch(changes).Value()) {
+			return 2
+		}
+	} else {
+		opts := DiffTextOptions{Color: !spec.NoColor && isTerminal(os.Stdout)}
+		if err := WriteDiff(os.Stdout, changes, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err)
+			return 2
+		}
+	}
+
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// writeValue prints v to stdout laid out as the spec asks.
+func writeValue(spec Spec, v Value) bool {
+	if err := Format(os.Stdout, v, spec.FormatOptions()); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err)
+		return false
+	}
+	fmt.Println()
+	return true
+}
+
+// parseSource reads a whole document, reporting any problems with it. A
+// sequence isn't expected here, so only one value is read whatever the spec
+// says.
+func parseSource(spec Spec, name string, src io.Reader) (Value, bool) {
+	opts := spec.ParseOptions()
+	opts.Sequence = false
+	p := NewParserWithOptions(src, opts)
+	doc, err := p.Parse()
+	reportWarnings(os.Stderr, name+": ", p.Warnings())
+	if err != nil {
+		reportErrors(name+": ", err)
+		return nil, false
+	}
+	return doc, true
+}
+
+// eachDocument calls fn with the document in the source, or with each of its
+// values in sequence mode, along with their positions if they were tracked.
+// Problems are reported as they are found and a bad value doesn't stop the
+// rest being read, but false is returned if any were bad or fn failed.
+func eachDocument(name string, src io.Reader, opts Options, fn func(Value, Positions) bool) bool {
+	p := NewParserWithOptions(src, opts)
+	ok, warned := true, 0
+	for {
+		doc, err := p.Parse()
+		if err == io.EOF {
+			return ok
+		}
+		warnings := p.Warnings()
+		reportWarnings(os.Stderr, name+": ", warnings[warned:])
+		warned = len(warnings)
+
+		var errs ErrorList
+		switch {
+		case errors.As(err, &errs):
+			reportErrors(name+": ", err)
+			ok = false
+		case err != nil:
+			reportErrors(name+": ", err)
+			return false
+		default:
+			ok = fn(doc, p.Positions()) && ok
+		}
+		if !opts.Sequence {
+			return ok
+		}
+	}
+}
+
+func reportErrors(prefix string, err error) {
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		fmt.Printf("%sBad JSON: %s\n", prefix, err)
+		return
+	}
+	for _, err := range errs {
+		fmt.Printf("%sBad JSON: %s\n", prefix, err)
+	}
+}
+
+func reportWarnings(w io.Writer, prefix string, warnings ErrorList) {
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "%sWarning: %s\n", prefix, warning)
+	}
+}
+
+func openSource(name string) (io.ReadCloser, error) {
+	if name != "stdin" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file %q: %w", name, err)
+		}
+		return f, nil
+	}
+
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat stdin: %w", err)
+	}
+	if (info.Mode() & os.ModeCharDevice) != 0 {
+		return nil, errors.New("no json source provided")
+	}
+
+	return os.Stdin, nil
+}
 
-	return f, nil
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && (info.Mode()&os.ModeCharDevice) != 0
 }
 
 func closeSource(src io.Closer) {
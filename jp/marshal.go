@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// MarshalError says which Go value couldn't be turned into JSON. Err, if set,
+// says why.
+type MarshalError struct {
+	Path Pointer
+	Type reflect.Type
+	Err  error
+}
+
+func (e *MarshalError) Error() string {
+	msg := fmt.Sprintf("%s: cannot marshal %s", describePath(e.Path), e.Type)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *MarshalError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	numberLiteral     = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+)
+
+// Marshal returns v as compact JSON, following the same rules as Unmarshal
+// in reverse: structs become objects with a member for each exported field
+// named by its json tag, maps become objects with their keys in order, types
+// implementing encoding.TextMarshaler become strings and []byte is base64
+// encoded. A Value is written as it is.
+func Marshal(v any) ([]byte, error) {
+	return MarshalWithOptions(v, FormatOptions{})
+}
+
+// MarshalWithOptions returns v as JSON laid out and escaped as described by
+// opts.
+func MarshalWithOptions(v any, opts FormatOptions) ([]byte, error) {
+	doc, err := toValue(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Format(&buf, doc, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encoder writes a stream of Go values to w as JSON, one after another.
+type Encoder struct {
+	w    io.Writer
+	opts FormatOptions
+}
+
+func NewEncoder(w io.Writer) Encoder {
+	return NewEncoderWithOptions(w, FormatOptions{})
+}
+
+func NewEncoderWithOptions(w io.Writer, opts FormatOptions) Encoder {
+	return Encoder{w: w, opts: opts}
+}
+
+// Encode writes v followed by a newline, so compact values form a JSON Lines
+// stream. Nothing is written if v can't be marshalled.
+func (e *Encoder) Encode(v any) error {
+	doc, err := toValue(v)
+	if err != nil {
+		return err
+	}
+	if err := Format(e.w, doc, e.opts); err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.w, "\n")
+	return err
+}
+
+func toValue(v any) (Value, error) {
+	var e encoder
+	return e.value(reflect.ValueOf(v), Pointer{}, 0)
+}
+
+type encoder struct{}
+
+func (e *encoder) fail(rv reflect.Value, path Pointer, err error) *MarshalError {
+	return &MarshalError{Path: slices.Clone(path), Type: rv.Type(), Err: err}
+}
+
+// value converts rv to a document. Depth counts every value passed through,
+// including pointers and interfaces, so that cycles are caught.
+func (e *encoder) value(rv reflect.Value, path Pointer, depth int) (Value, error) {
+	if !rv.IsValid() {
+		return &Null{}, nil
+	}
+	if depth > DefaultMaxDepth {
+		return nil, e.fail(rv, path, errors.New("too deeply nested, is there a cycle?"))
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if rv.IsNil() {
+			return &Null{}, nil
+		}
+	}
+	if rv.Type().Implements(nodeType) {
+		return rv.Interface().(Value), nil
+	}
+	if rv.Type() == numberType {
+		return e.number(rv, path)
+	}
+	if rv.Kind() != reflect.Pointer && rv.CanAddr() && reflect.PointerTo(rv.Type()).Implements(textMarshalerType) {
+		rv = rv.Addr()
+	}
+	if rv.Type().Implements(textMarshalerType) {
+		text, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, e.fail(rv, path, err)
+		}
+		return &String{Value: string(text)}, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return e.value(rv.Elem(), path, depth+1)
+	case reflect.Bool:
+		return &Bool{Value: rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Number{Literal: strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Number{Literal: strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, e.fail(rv, path, fmt.Errorf("%v is not a JSON number", f))
+		}
+		return &Number{Literal: formatES(f, rv.Type().Bits())}, nil
+	case reflect.String:
+		return &String{Value: rv.String()}, nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && !rv.Type().Elem().Implements(textMarshalerType) {
+			return &String{Value: base64.StdEncoding.EncodeToString(rv.Bytes())}, nil
+		}
+		return e.array(rv, path, depth)
+	case reflect.Array:
+		return e.array(rv, path, depth)
+	case reflect.Map:
+		return e.object(rv, path, depth)
+	case reflect.Struct:
+		return e.structure(rv, path, depth)
+	}
+	return nil, e.fail(rv, path, nil)
+}
+
+func (e *encoder) number(rv reflect.Value, path Pointer) (Value, error) {
+	n := rv.Interface().(Number)
+	if n.Literal == "" {
+		return &Number{Literal: "0"}, nil
+	}
+	if !numberLiteral.MatchString(n.Literal) {
+		return nil, e.fail(rv, path, fmt.Errorf("%q is not a JSON number", n.Literal))
+	}
+	return &n, nil
+}
+
+func (e *encoder) array(rv reflect.Value, path Pointer, depth int) (Value, error) {
+	arr := &Array{Elems: make([]Value, 0, rv.Len())}
+	for i := range rv.Len() {
+		v, err := e.value(rv.Index(i), append(path, strconv.Itoa(i)), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		arr.Elems = append(arr.Elems, v)
+	}
+	return arr, nil
+}
+
+// object converts a map, writing its members in key order so the output
+// doesn't change from one run to the next.
+func (e *encoder) object(rv reflect.Value, path Pointer, depth int) (Value, error) {
+	obj := &Object{Members: make([]Member, 0, rv.Len())}
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := mapKeyName(iter.Key())
+		if err != nil {
+			return nil, e.fail(rv, path, err)
+		}
+		v, err := e.value(iter.Value(), append(path, key), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		obj.Members = append(obj.Members, Member{Key: key, Value: v})
+	}
+	slices.SortFunc(obj.Members, func(a, b Member) int {
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return obj, nil
+}
+
+func mapKeyName(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	if tm, ok := key.Interface().(encoding.TextMarshaler); ok {
+		if key.Kind() == reflect.Pointer && key.IsNil() {
+			return "", nil
+		}
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("unsupported map key type %s", key.Type())
+}
+
+func (e *encoder) structure(rv reflect.Value, path Pointer, depth int) (Value, error) {
+	obj := &Object{Members: []Member{}}
+	for _, f := range structFields(rv.Type()) {
+		fv, ok := embeddedField(rv, f.index)
+		if !ok || f.omitEmpty && isEmpty(fv) {
+			continue
+		}
+
+		v, err := e.value(fv, append(path, f.name), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if f.quoted {
+			v = quote(v)
+		}
+		obj.Members = append(obj.Members, Member{Key: f.name, Value: v})
+	}
+	return obj, nil
+}
+
+// embeddedField finds a possibly promoted field, reporting false if it is
+// reached through an embedded struct pointer that is nil.
+func embeddedField(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return rv, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+// isEmpty reports whether the omitempty tag option leaves out rv.
+func isEmpty(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return rv.IsZero()
+	}
+	return false
+}
+
+// quote wraps a scalar in a string for a field with the string tag option.
+// Null is left as it is.
+func quote(v Value) Value {
+	switch v.(type) {
+	case *Null, *Array, *Object:
+		return v
+	}
+	return &String{Value: string(appendScalar(nil, v, FormatOptions{}))}
+}
@@ -0,0 +1,217 @@
+package main_test
+
+import (
+	"errors"
+	"math"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+type Listing struct {
+	Base
+	*Meta
+	Name    string            `json:"name"`
+	Port    int               `json:"port,omitempty"`
+	Ratio   float32           `json:"ratio"`
+	Count   int64             `json:"count,string"`
+	Label   string            `json:"label,string"`
+	Enabled *bool             `json:"enabled"`
+	Addr    netip.Addr        `json:"addr"`
+	Data    []byte            `json:"data"`
+	Env     map[string]int    `json:"env,omitempty"`
+	Extra   any               `json:"extra"`
+	Raw     jp.Value          `json:"raw"`
+	Size    jp.Number         `json:"size"`
+	Skipped string            `json:"-"`
+	Empty   map[string]string `json:"empty"`
+	hidden  int
+}
+
+func TestMarshalStruct(t *testing.T) {
+	v := Listing{
+		Base:   Base{ID: 3, Created: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		Name:   "web",
+		Ratio:  0.1,
+		Count:  12,
+		Label:  "a",
+		Addr:   netip.MustParseAddr("10.0.0.1"),
+		Data:   []byte("hi"),
+		Extra:  []any{1, "two", nil},
+		Raw:    &jp.Object{Members: []jp.Member{{Key: "z", Value: &jp.Null{}}}},
+		Size:   jp.Number{Literal: "1e400"},
+		hidden: 1,
+	}
+	want := `{"id":3,"Created":"2024-05-01T10:00:00Z","name":"web","ratio":0.1,"count":"12","label":"\"a\"",` +
+		`"enabled":null,"addr":"10.0.0.1","data":"aGk=","extra":[1,"two",null],"raw":{"z":null},"size":1e400,"empty":null}`
+
+	got, err := jp.Marshal(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("Bad JSON: got %s, want %s", got, want)
+	}
+
+	var back Listing
+	if err := jp.Unmarshal(got, &back); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(back.Base, v.Base) || back.Count != v.Count || back.Label != v.Label || string(back.Data) != "hi" {
+		t.Fatalf("Bad round trip: got %+v, want %+v", back, v)
+	}
+}
+
+func TestMarshalValues(t *testing.T) {
+	testCases := []struct {
+		desc string
+		v    any
+		want string
+	}{
+		{desc: "nil", v: nil, want: `null`},
+		{desc: "int", v: -7, want: `-7`},
+		{desc: "uint", v: uint64(math.MaxUint64), want: `18446744073709551615`},
+		{desc: "float", v: 1e21, want: `1e+21`},
+		{desc: "small float", v: 0.000001, want: `0.000001`},
+		{desc: "float32", v: float32(0.1), want: `0.1`},
+		{desc: "string", v: "a\"b\n", want: `"a\"b\n"`},
+		{desc: "nil slice", v: []int(nil), want: `null`},
+		{desc: "empty slice", v: []int{}, want: `[]`},
+		{desc: "array", v: [2]bool{true, false}, want: `[true,false]`},
+		{desc: "sorted map", v: map[string]int{"b": 2, "a": 1, "c": 3}, want: `{"a":1,"b":2,"c":3}`},
+		{desc: "int keys", v: map[int]bool{10: true, 9: false}, want: `{"10":true,"9":false}`},
+		{desc: "text keys", v: map[netip.Addr]int{netip.MustParseAddr("::1"): 1}, want: `{"::1":1}`},
+		{desc: "pointer", v: func() *int { i := 4; return &i }(), want: `4`},
+		{desc: "empty number", v: jp.Number{}, want: `0`},
+		{desc: "empty struct", v: struct{}{}, want: `{}`},
+		{
+			desc: "omitempty",
+			v: struct {
+				A int     `json:"a,omitempty"`
+				B string  `json:"b,omitempty"`
+				C []int   `json:"c,omitempty"`
+				D *int    `json:"d,omitempty"`
+				E any     `json:"e,omitempty"`
+				F float64 `json:"f,omitempty"`
+				G bool    `json:"g,omitempty"`
+			}{},
+			want: `{}`,
+		},
+		{
+			desc: "quoted",
+			v: struct {
+				B bool    `json:"b,string"`
+				F float64 `json:"f,string"`
+				P *int    `json:"p,string"`
+				S []int   `json:"s,string"`
+			}{B: true, F: 1.5, S: []int{1}},
+			want: `{"b":"true","f":"1.5","p":null,"s":[1]}`,
+		},
+		{desc: "shadowed field", v: Outer{Inner: Inner{Name: "y"}, Name: "x"}, want: `{"Note":"","name":"x"}`},
+		{desc: "nil embedded pointer", v: Listing{}, want: `{"id":0,"Created":"0001-01-01T00:00:00Z","name":"","ratio":0,"count":"0","label":"\"\"","enabled":null,"addr":"","data":null,"extra":null,"raw":null,"size":0,"empty":null}`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := jp.Marshal(tC.v)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tC.want {
+				t.Fatalf("Bad JSON: got %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestMarshalOptions(t *testing.T) {
+	v := map[string]any{"html": "<a href='x'>&</a>", "text": "é😀\u2028", "list": []int{1, 2}}
+	testCases := []struct {
+		desc string
+		opts jp.FormatOptions
+		want string
+	}{
+		{
+			desc: "compact",
+			want: `{"html":"<a href='x'>&</a>","list":[1,2],"text":"é😀` + "\u2028" + `"}`,
+		},
+		{
+			desc: "html",
+			opts: jp.FormatOptions{EscapeHTML: true},
+			want: `{"html":"\u003ca href='x'\u003e\u0026\u003c/a\u003e","list":[1,2],"text":"é😀\u2028"}`,
+		},
+		{
+			desc: "ascii",
+			opts: jp.FormatOptions{ASCII: true},
+			want: `{"html":"<a href='x'>&</a>","list":[1,2],"text":"\u00e9\ud83d\ude00\u2028"}`,
+		},
+		{
+			desc: "indent",
+			opts: jp.FormatOptions{Indent: "  ", ArrayWidth: 20},
+			want: "{\n  \"html\": \"<a href='x'>&</a>\",\n  \"list\": [1, 2],\n  \"text\": \"é😀\u2028\"\n}",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := jp.MarshalWithOptions(v, tC.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tC.want {
+				t.Fatalf("Bad JSON: got %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+type cycle struct {
+	Next *cycle
+}
+
+func TestMarshalErrors(t *testing.T) {
+	loop := &cycle{}
+	loop.Next = loop
+	testCases := []struct {
+		desc string
+		v    any
+		err  string
+	}{
+		{desc: "nan", v: map[string]float64{"x": math.NaN()}, err: "/x: cannot marshal float64: NaN is not a JSON number"},
+		{desc: "inf", v: []float32{float32(math.Inf(1))}, err: "/0: cannot marshal float32: +Inf is not a JSON number"},
+		{desc: "channel", v: struct{ C chan int }{make(chan int)}, err: "/C: cannot marshal chan int"},
+		{desc: "bad number", v: jp.Number{Literal: "0x10"}, err: `(root): cannot marshal main.Number: "0x10" is not a JSON number`},
+		{desc: "bad key", v: map[float64]int{1: 1}, err: "(root): cannot marshal map[float64]int: unsupported map key type float64"},
+		{desc: "cycle", v: loop, err: "is there a cycle?"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := jp.Marshal(tC.v)
+			var merr *jp.MarshalError
+			if !errors.As(err, &merr) {
+				t.Fatalf("Bad error: got %v, want a MarshalError", err)
+			}
+			if !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("Bad message: got %q, want %q", err.Error(), tC.err)
+			}
+		})
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var buf strings.Builder
+	enc := jp.NewEncoder(&buf)
+	for _, v := range []any{map[string]int{"a": 1}, []string{"x"}, 3} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := enc.Encode(math.Inf(1)); err == nil {
+		t.Fatalf("Got nil but wanted error")
+	}
+	if want := "{\"a\":1}\n[\"x\"]\n3\n"; buf.String() != want {
+		t.Fatalf("Bad stream: got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrMergeConflict = errors.New("cannot merge")
+
+// MergePatch applies an RFC 7386 merge patch to doc and returns the result,
+// leaving doc as it was. Members of the patch replace those of the document,
+// objects are merged recursively and a null removes a member.
+func MergePatch(doc, patch Value) Value {
+	if doc != nil {
+		doc = Clone(doc)
+	}
+	return mergePatch(doc, patch)
+}
+
+func mergePatch(target, patch Value) Value {
+	p, ok := patch.(*Object)
+	if !ok {
+		return Clone(patch)
+	}
+	t, ok := target.(*Object)
+	if !ok {
+		t = &Object{Members: []Member{}}
+	}
+
+	for _, m := range p.Members {
+		if _, ok := m.Value.(*Null); ok {
+			t.Delete(m.Key)
+			continue
+		}
+		cur, _ := t.Get(m.Key)
+		t.Set(m.Key, mergePatch(cur, m.Value))
+	}
+	return t
+}
+
+type ArrayStrategy string
+
+const (
+	// ReplaceArrays has later layers replace arrays outright.
+	ReplaceArrays ArrayStrategy = "replace"
+	// ConcatArrays appends the elements from later layers.
+	ConcatArrays ArrayStrategy = "concat"
+	// MergeArraysByKey matches elements up by MergeOptions.ArrayKey, merging
+	// those that match and appending the rest.
+	MergeArraysByKey ArrayStrategy = "key"
+)
+
+// MergeOptions controls how Merge combines layers. The zero value replaces
+// arrays.
+type MergeOptions struct {
+	Arrays   ArrayStrategy
+	ArrayKey string
+}
+
+// Layer is one document to be merged, named for reporting where values came
+// from.
+type Layer struct {
+	Name string
+	Doc  Value
+}
+
+// Origin says which layer set a value in a merged document. Overrides lists
+// the earlier layers whose different values it replaced.
+type Origin struct {
+	Path      Pointer
+	Layer     string
+	Overrides []string
+}
+
+func (o Origin) String() string {
+	path := describePath(o.Path)
+	if len(o.Overrides) == 0 {
+		return fmt.Sprintf("%s: %s", path, o.Layer)
+	}
+	return fmt.Sprintf("%s: %s (overrides %s)", path, o.Layer, strings.Join(o.Overrides, ", "))
+}
+
+// Merge deep merges the layers in order, later ones taking precedence. As
+// well as the merged document it returns the origin of every scalar and empty
+// container in it, in document order.
+func Merge(layers []Layer, opts MergeOptions) (Value, []Origin, error) {
+	switch opts.Arrays {
+	case "":
+		opts.Arrays = ReplaceArrays
+	case ReplaceArrays, ConcatArrays:
+	case MergeArraysByKey:
+		if opts.ArrayKey == "" {
+			return nil, nil, errors.New("merging arrays by key needs a key")
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown array strategy %q", opts.Arrays)
+	}
+
+	m := merger{opts: opts, origins: map[string]*Origin{}}
+	var doc Value
+	for i, l := range layers {
+		if i == 0 {
+			doc = Clone(l.Doc)
+			m.claim(Pointer{}, doc, l.Name, nil)
+			continue
+		}
+		var err error
+		if doc, err = m.merge(Pointer{}, doc, l.Doc, l.Name); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var origins []Origin
+	m.collect(Pointer{}, doc, &origins)
+	return doc, origins, nil
+}
+
+type merger struct {
+	opts    MergeOptions
+	origins map[string]*Origin
+}
+
+func (m *merger) merge(path Pointer, cur, next Value, layer string) (Value, error) {
+	switch c := cur.(type) {
+	case *Object:
+		if n, ok := next.(*Object); ok {
+			return c, m.object(path, c, n, layer)
+		}
+	case *Array:
+		if n, ok := next.(*Array); ok && m.opts.Arrays != ReplaceArrays {
+			return c, m.array(path, c, n, layer)
+		}
+	}
+	return m.replace(path, cur, next, layer), nil
+}
+
+func (m *merger) object(path Pointer, cur, next *Object, layer string) error {
+	for _, k := range uniqueKeys(next) {
+		nv, _ := next.Get(k)
+		child := append(path, k)
+		cv, ok := cur.Get(k)
+		if !ok {
+			nv = Clone(nv)
+			cur.Set(k, nv)
+			m.claim(child, nv, layer, nil)
+			continue
+		}
+		merged, err := m.merge(child, cv, nv, layer)
+		if err != nil {
+			return err
+		}
+		cur.Set(k, merged)
+	}
+	return nil
+}
+
+func (m *merger) array(path Pointer, cur, next *Array, layer string) error {
+	for i, nv := range next.Elems {
+		if m.opts.Arrays == MergeArraysByKey {
+			j, err := m.match(path, cur, nv, layer, i)
+			if err != nil {
+				return err
+			}
+			if j >= 0 {
+				child := append(path, strconv.Itoa(j))
+				merged, err := m.merge(child, cur.Elems[j], nv, layer)
+				if err != nil {
+					return err
+				}
+				cur.Elems[j] = merged
+				continue
+			}
+		}
+		nv = Clone(nv)
+		cur.Elems = append(cur.Elems, nv)
+		m.claim(append(path, strconv.Itoa(len(cur.Elems)-1)), nv, layer, nil)
+	}
+	return nil
+}
+
+// match finds the element of arr that v should be merged into, or -1 if
+// there isn't one. Objects are matched by their key; anything else only
+// matches an equal value, so arrays of scalars end up as a union.
+func (m *merger) match(path Pointer, arr *Array, v Value, layer string, i int) (int, error) {
+	obj, ok := v.(*Object)
+	if !ok {
+		return slices.IndexFunc(arr.Elems, func(e Value) bool { return Equal(e, v) }), nil
+	}
+	id, ok := obj.Get(m.opts.ArrayKey)
+	if !ok {
+		return 0, fmt.Errorf(
+			"%w %s by %q: element %d in %s has no such member",
+			ErrMergeConflict,
+			describePath(path),
+			m.opts.ArrayKey,
+			i,
+			layer,
+		)
+	}
+	return slices.IndexFunc(arr.Elems, func(e Value) bool {
+		obj, ok := e.(*Object)
+		if !ok {
+			return false
+		}
+		eid, ok := obj.Get(m.opts.ArrayKey)
+		return ok && Equal(eid, id)
+	}), nil
+}
+
+// replace puts next in place of cur, noting which layers' values it
+// overrode, including those they had overridden in turn.
+func (m *merger) replace(path Pointer, cur, next Value, layer string) Value {
+	var overrides []string
+	m.release(path, cur, &overrides)
+	if Equal(cur, next) {
+		overrides = nil
+	}
+	slices.Sort(overrides)
+	overrides = slices.Compact(overrides)
+	if i := slices.Index(overrides, layer); i >= 0 {
+		overrides = slices.Delete(overrides, i, i+1)
+	}
+
+	next = Clone(next)
+	m.claim(path, next, layer, overrides)
+	return next
+}
+
+// release forgets who set v and everything within it, adding the layers that
+// did to layers. Every origin under path belongs to a value within v, so only
+// those need looking up.
+func (m *merger) release(path Pointer, v Value, layers *[]string) {
+	key := path.String()
+	if o, ok := m.origins[key]; ok {
+		*layers = append(*layers, o.Layer)
+		*layers = append(*layers, o.Overrides...)
+		delete(m.origins, key)
+	}
+	switch v := v.(type) {
+	case *Object:
+		for _, mem := range v.Members {
+			m.release(append(path, mem.Key), mem.Value, layers)
+		}
+	case *Array:
+		for i, e := range v.Elems {
+			m.release(append(path, strconv.Itoa(i)), e, layers)
+		}
+	}
+}
+
+// claim records that layer set v and everything within it.
+func (m *merger) claim(path Pointer, v Value, layer string, overrides []string) {
+	switch v := v.(type) {
+	case *Object:
+		if len(v.Members) > 0 {
+			for _, mem := range v.Members {
+				m.claim(append(path, mem.Key), mem.Value, layer, overrides)
+			}
+			return
+		}
+	case *Array:
+		if len(v.Elems) > 0 {
+			for i, e := range v.Elems {
+				m.claim(append(path, strconv.Itoa(i)), e, layer, overrides)
+			}
+			return
+		}
+	}
+	m.origins[path.String()] = &Origin{Path: slices.Clone(path), Layer: layer, Overrides: overrides}
+}
+
+func (m *merger) collect(path Pointer, v Value, out *[]Origin) {
+	switch v := v.(type) {
+	case *Object:
+		if len(v.Members) > 0 {
+			for _, mem := range v.Members {
+				m.collect(append(path, mem.Key), mem.Value, out)
+			}
+			return
+		}
+	case *Array:
+		if len(v.Elems) > 0 {
+			for i, e := range v.Elems {
+				m.collect(append(path, strconv.Itoa(i)), e, out)
+			}
+			return
+		}
+	}
+	if o, ok := m.origins[path.String()]; ok {
+		*out = append(*out, *o)
+	}
+}
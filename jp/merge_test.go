@@ -0,0 +1,175 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestMergePatch(t *testing.T) {
+	testCases := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{doc: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{doc: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{doc: `["a","b"]`, patch: `["c","d"]`, want: `["c","d"]`},
+		{doc: `{"a":"b"}`, patch: `["c"]`, want: `["c"]`},
+		{doc: `{"a":"foo"}`, patch: `null`, want: `null`},
+		{doc: `{"a":"foo"}`, patch: `"bar"`, want: `"bar"`},
+		{doc: `{"e":null}`, patch: `{"a":1}`, want: `{"e":null,"a":1}`},
+		{doc: `[1,2]`, patch: `{"a":"b","c":null}`, want: `{"a":"b"}`},
+		{doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.doc+" "+tC.patch, func(t *testing.T) {
+			doc := parse(t, tC.doc)
+			got := jp.FormatString(jp.MergePatch(doc, parse(t, tC.patch)), jp.FormatOptions{})
+			if got != tC.want {
+				t.Fatalf("Bad merge: got %s, want %s", got, tC.want)
+			}
+			if after := jp.FormatString(doc, jp.FormatOptions{}); after != jp.FormatString(parse(t, tC.doc), jp.FormatOptions{}) {
+				t.Fatalf("Original modified: got %s", after)
+			}
+		})
+	}
+}
+
+const (
+	baseLayer  = `{"db": {"host": "localhost", "port": 5432}, "tags": ["a"], "users": [{"id": 1, "role": "admin"}]}`
+	envLayer   = `{"db": {"host": "prod.example.com"}, "tags": ["b", "a"], "users": [{"id": 2, "role": "dev"}, {"id": 1, "name": "root"}]}`
+	localLayer = `{"db": {"port": 5432, "debug": true}, "tags": "none"}`
+)
+
+func TestMerge(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		opts    jp.MergeOptions
+		want    string
+		origins string
+	}{
+		{
+			desc: "replace arrays",
+			want: `{"db":{"host":"prod.example.com","port":5432,"debug":true},"tags":"none","users":[{"id":2,"role":"dev"},{"id":1,"name":"root"}]}`,
+			origins: `/db/host: env.json (overrides base.json)
+/db/port: local.json
+/db/debug: local.json
+/tags: local.json (overrides base.json, env.json)
+/users/0/id: env.json (overrides base.json)
+/users/0/role: env.json (overrides base.json)
+/users/1/id: env.json (overrides base.json)
+/users/1/name: env.json (overrides base.json)`,
+		},
+		{
+			desc: "concatenate arrays",
+			opts: jp.MergeOptions{Arrays: jp.ConcatArrays},
+			want: `{"db":{"host":"prod.example.com","port":5432,"debug":true},"tags":"none","users":[{"id":1,"role":"admin"},{"id":2,"role":"dev"},{"id":1,"name":"root"}]}`,
+			origins: `/db/host: env.json (overrides base.json)
+/db/port: local.json
+/db/debug: local.json
+/tags: local.json (overrides base.json, env.json)
+/users/0/id: base.json
+/users/0/role: base.json
+/users/1/id: env.json
+/users/1/role: env.json
+/users/2/id: env.json
+/users/2/name: env.json`,
+		},
+		{
+			desc: "merge arrays by key",
+			opts: jp.MergeOptions{Arrays: jp.MergeArraysByKey, ArrayKey: "id"},
+			want: `{"db":{"host":"prod.example.com","port":5432,"debug":true},"tags":"none","users":[{"id":1,"role":"admin","name":"root"},{"id":2,"role":"dev"}]}`,
+			origins: `/db/host: env.json (overrides base.json)
+/db/port: local.json
+/db/debug: local.json
+/tags: local.json (overrides env.json)
+/users/0/id: env.json
+/users/0/role: base.json
+/users/0/name: env.json
+/users/1/id: env.json
+/users/1/role: env.json`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			layers := []jp.Layer{
+				{Name: "base.json", Doc: parse(t, baseLayer)},
+				{Name: "env.json", Doc: parse(t, envLayer)},
+				{Name: "local.json", Doc: parse(t, localLayer)},
+			}
+			doc, origins, err := jp.Merge(layers, tC.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := jp.FormatString(doc, jp.FormatOptions{}); got != tC.want {
+				t.Fatalf("Bad merge: got %s, want %s", got, tC.want)
+			}
+
+			lines := make([]string, 0, len(origins))
+			for _, o := range origins {
+				lines = append(lines, o.String())
+			}
+			if got := strings.Join(lines, "\n"); got != tC.origins {
+				t.Fatalf("Bad origins: got\n%s\nwant\n%s", got, tC.origins)
+			}
+			if got := jp.FormatString(layers[0].Doc, jp.FormatOptions{}); got != jp.FormatString(parse(t, baseLayer), jp.FormatOptions{}) {
+				t.Fatalf("Layer modified: got %s", got)
+			}
+		})
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	layers := []jp.Layer{
+		{Name: "a.json", Doc: parse(t, `{"xs": [{"id": 1}]}`)},
+		{Name: "b.json", Doc: parse(t, `{"xs": [{"name": "x"}]}`)},
+	}
+	_, _, err := jp.Merge(layers, jp.MergeOptions{Arrays: jp.MergeArraysByKey, ArrayKey: "id"})
+	if !errors.Is(err, jp.ErrMergeConflict) {
+		t.Fatalf("Bad error: got %v, want %v", err, jp.ErrMergeConflict)
+	}
+
+	if _, _, err := jp.Merge(layers, jp.MergeOptions{Arrays: jp.MergeArraysByKey}); err == nil {
+		t.Fatalf("Got nil but wanted error for missing key")
+	}
+	if _, _, err := jp.Merge(layers, jp.MergeOptions{Arrays: "zip"}); err == nil {
+		t.Fatalf("Got nil but wanted error for unknown strategy")
+	}
+}
+
+func BenchmarkMerge(b *testing.B) {
+	layers := make([]jp.Layer, 50)
+	for i := range layers {
+		var buf strings.Builder
+		buf.WriteString("{")
+		for k := range 500 {
+			if k > 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprintf(&buf, `"k%d": {"v": %d}`, k, i)
+		}
+		buf.WriteString("}")
+		p := jp.NewParser(strings.NewReader(buf.String()))
+		doc, err := p.Parse()
+		if err != nil {
+			b.Fatalf("Unexpected error: %v", err)
+		}
+		layers[i] = jp.Layer{Name: fmt.Sprintf("layer%d.json", i), Doc: doc}
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, err := jp.Merge(layers, jp.MergeOptions{}); err != nil {
+			b.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
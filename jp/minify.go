@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// Minify copies the document read from src to w with all insignificant
+// whitespace removed. It works from the event stream so the document is never
+// held in memory, and strings and numbers are copied exactly as they appear in
+// the input. On error w holds whatever had been written up to that point.
+func Minify(w io.Writer, src io.Reader) error {
+	return minifyValues(w, src, Options{})
+}
+
+// MinifySequence is Minify for a sequence of values, concatenated or separated
+// by RS characters, writing each of them on a line of its own.
+func MinifySequence(w io.Writer, src io.Reader) error {
+	return minifyValues(w, src, Options{Sequence: true})
+}
+
+func minifyValues(w io.Writer, src io.Reader, opts Options) error {
+	out := bufio.NewWriter(w)
+	needComma := false
+	depth := 0
+
+	err := Walk(src, opts, func(ev Event) error {
+		switch {
+		case needComma && depth == 0:
+			out.WriteByte('\n')
+		case needComma && ev.Type != End:
+			out.WriteByte(',')
+		}
+		needComma = true
+
+		switch ev.Type {
+		case StartObject, StartArray:
+			out.WriteString(ev.Token.Literal)
+			needComma = false
+			depth++
+		case End:
+			writeRaw(out, ev.Token)
+			depth--
+		case Key:
+			writeRaw(out, ev.Token)
+			out.WriteByte(':')
+			needComma = false
+		default:
+			writeRaw(out, ev.Token)
+		}
+		return nil
+	})
+	if err != nil {
+		out.Flush()
+		return err
+	}
+
+	return out.Flush()
+}
+
+// writeRaw writes a token as it appeared in the input.
+func writeRaw(out *bufio.Writer, tok Token) {
+	if tok.Type == STRING {
+		out.WriteByte('"')
+		out.WriteString(tok.Literal)
+		out.WriteByte('"')
+		return
+	}
+	out.WriteString(tok.Literal)
+}
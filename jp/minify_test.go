@@ -0,0 +1,61 @@
+package main_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestMinify(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		want string
+	}{
+		{desc: "scalar", data: "  true\n", want: "true"},
+		{desc: "empty containers", data: "[ { } , [ ] ]", want: "[{},[]]"},
+		{
+			desc: "nested",
+			data: "{\n  \"a\" : [ 1 , 2 ],\n\t\"b\":{ \"c\" : null }\r\n}",
+			want: `{"a":[1,2],"b":{"c":null}}`,
+		},
+		{
+			desc: "literals kept",
+			data: `[ 1.50E+03 , -0.0, "é\/\n" , "a b" ]`,
+			want: `[1.50E+03,-0.0,"é\/\n","a b"]`,
+		},
+		{desc: "escaped key", data: `{ "A" : "x" }`, want: `{"A":"x"}`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var out strings.Builder
+			if err := jp.Minify(&out, strings.NewReader(tC.data)); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := out.String(); got != tC.want {
+				t.Fatalf("Bad output, got %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestMinifySequence(t *testing.T) {
+	var out strings.Builder
+	err := jp.MinifySequence(&out, strings.NewReader("\x1e{ \"a\" : [ 1 ] }\n\x1e 2\n\x1e[ ]\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := out.String(), "{\"a\":[1]}\n2\n[]"; got != want {
+		t.Fatalf("Bad output, got %q, want %q", got, want)
+	}
+}
+
+func TestMinifyBadJson(t *testing.T) {
+	var out strings.Builder
+	err := jp.Minify(&out, strings.NewReader(`[1, 2 3]`))
+	if !errors.Is(err, jp.ErrUnexpectedToken) {
+		t.Fatalf("Wrong error, got %v, want %v", err, jp.ErrUnexpectedToken)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNumberRange     = errors.New("number out of range")
+	ErrNumberPrecision = errors.New("number would lose precision")
+)
+
+// NumberError says why a number couldn't be converted to the type asked for.
+// Err is ErrNumberRange or ErrNumberPrecision.
+type NumberError struct {
+	Literal string
+	Type    string
+	Err     error
+}
+
+func (e *NumberError) Error() string {
+	return fmt.Sprintf("cannot convert %s to %s: %s", e.Literal, e.Type, e.Err)
+}
+
+func (e *NumberError) Unwrap() error {
+	return e.Err
+}
+
+// Int64 converts the number to an int64, failing if it has a fractional part
+// or doesn't fit.
+func (n *Number) Int64() (int64, error) {
+	if i, err := strconv.ParseInt(n.Literal, 10, 64); err == nil {
+		return i, nil
+	}
+	digits, err := n.integer("int64")
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, &NumberError{n.Literal, "int64", ErrNumberRange}
+	}
+	return i, nil
+}
+
+// Uint64 converts the number to a uint64, failing if it is negative, has a
+// fractional part or doesn't fit.
+func (n *Number) Uint64() (uint64, error) {
+	if u, err := strconv.ParseUint(n.Literal, 10, 64); err == nil {
+		return u, nil
+	}
+	digits, err := n.integer("uint64")
+	if err != nil {
+		return 0, err
+	}
+	u, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return 0, &NumberError{n.Literal, "uint64", ErrNumberRange}
+	}
+	return u, nil
+}
+
+// integer writes the number out in full as an integer, as long as it is one
+// that could fit in 64 bits.
+func (n *Number) integer(typ string) (string, error) {
+	d, ok := parseDecimal(n.Literal)
+	switch {
+	case !ok:
+		return "", &NumberError{n.Literal, typ, ErrNumberRange}
+	case d.digits == "":
+		return "0", nil
+	case d.exp < 0:
+		return "", &NumberError{n.Literal, typ, ErrNumberPrecision}
+	case len(d.digits)+d.exp > 20:
+		return "", &NumberError{n.Literal, typ, ErrNumberRange}
+	}
+
+	digits := d.digits + strings.Repeat("0", d.exp)
+	if d.neg {
+		digits = "-" + digits
+	}
+	return digits, nil
+}
+
+// finite reports whether the number can be written as JSON, which isn't so
+// of the Infinity and NaN read from JSON5.
+func (n *Number) finite() bool {
+	switch n.Literal {
+	case "Infinity", "-Infinity", "NaN":
+		return false
+	}
+	return true
+}
+
+// Float64 converts the number to the nearest float64, failing if it is too
+// large or if that isn't the same number. Numbers like 0.1 count as the same
+// because the float64 is written back out with the same digits.
+func (n *Number) Float64() (float64, error) {
+	f, err := strconv.ParseFloat(n.Literal, 64)
+	if err != nil {
+		return f, &NumberError{n.Literal, "float64", ErrNumberRange}
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		// Only JSON5 can spell these and it means them exactly.
+		return f, nil
+	}
+
+	want, _ := parseDecimal(n.Literal)
+	got, _ := parseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+	if want != got && !(want.digits == "" && got.digits == "") {
+		return f, &NumberError{n.Literal, "float64", ErrNumberPrecision}
+	}
+	return f, nil
+}
+
+// BigFloat converts the number to a big.Float with prec bits of mantissa, or
+// 64 if prec is zero. Its Acc method says whether the number had to be
+// rounded to fit.
+func (n *Number) BigFloat(prec uint) (*big.Float, error) {
+	if prec == 0 {
+		prec = 64
+	}
+	f, _, err := big.ParseFloat(n.Literal, 10, prec, big.ToNearestEven)
+	if err != nil {
+		return nil, &NumberError{n.Literal, "big.Float", ErrNumberRange}
+	}
+	return f, nil
+}
+
+// Rat converts the number to a big.Rat, which holds it exactly.
+func (n *Number) Rat() (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(n.Literal)
+	if !ok {
+		return nil, &NumberError{n.Literal, "big.Rat", ErrNumberRange}
+	}
+	return r, nil
+}
+
+// decimal is a number broken down into its significant digits, with no
+// leading or trailing zeros, and the power of ten they are multiplied by.
+// Zero has no digits.
+type decimal struct {
+	neg    bool
+	digits string
+	exp    int
+}
+
+// parseDecimal breaks down a JSON number without doing any arithmetic on it,
+// so even numbers with huge exponents are cheap. Exponents too large for an
+// int are clamped, which is still far outside anything a conversion accepts.
+func parseDecimal(lit string) (decimal, bool) {
+	var d decimal
+	if strings.HasPrefix(lit, "-") {
+		d.neg = true
+		lit = lit[1:]
+	}
+
+	mantissa, exp, hasExp := strings.Cut(strings.ToLower(lit), "e")
+	whole, frac, _ := strings.Cut(mantissa, ".")
+	if whole == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return decimal{}, false
+	}
+	if hasExp {
+		e, err := strconv.ParseInt(exp, 10, 32)
+		if err != nil {
+			var numErr *strconv.NumError
+			if !errors.As(err, &numErr) || numErr.Err != strconv.ErrRange {
+				return decimal{}, false
+			}
+			e = math.MaxInt32
+			if strings.HasPrefix(exp, "-") {
+				e = math.MinInt32
+			}
+		}
+		d.exp = int(e)
+	}
+
+	digits := strings.TrimLeft(whole+frac, "0")
+	d.exp -= len(frac)
+	trimmed := strings.TrimRight(digits, "0")
+	d.exp += len(digits) - len(trimmed)
+	d.digits = trimmed
+	if d.digits == "" {
+		return decimal{neg: d.neg}, true
+	}
+	return d, true
+}
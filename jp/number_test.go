@@ -0,0 +1,128 @@
+package main_test
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestNumberInt64(t *testing.T) {
+	testCases := []struct {
+		lit  string
+		want int64
+		err  error
+	}{
+		{lit: "0", want: 0},
+		{lit: "-0", want: 0},
+		{lit: "42", want: 42},
+		{lit: "-9223372036854775808", want: math.MinInt64},
+		{lit: "9223372036854775807", want: math.MaxInt64},
+		{lit: "1e3", want: 1000},
+		{lit: "1.5E1", want: 15},
+		{lit: "12300e-2", want: 123},
+		{lit: "0.0e5", want: 0},
+		{lit: "9223372036854775808", err: jp.ErrNumberRange},
+		{lit: "1e19", err: jp.ErrNumberRange},
+		{lit: "1e1000000000000", err: jp.ErrNumberRange},
+		{lit: "1.5", err: jp.ErrNumberPrecision},
+		{lit: "1e-1", err: jp.ErrNumberPrecision},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.lit, func(t *testing.T) {
+			got, err := (&jp.Number{Literal: tC.lit}).Int64()
+			if !errors.Is(err, tC.err) {
+				t.Fatalf("Bad error: got %v, want %v", err, tC.err)
+			}
+			if got != tC.want {
+				t.Fatalf("Bad int64: got %d, want %d", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestNumberUint64(t *testing.T) {
+	testCases := []struct {
+		lit  string
+		want uint64
+		err  error
+	}{
+		{lit: "18446744073709551615", want: math.MaxUint64},
+		{lit: "1.8e1", want: 18},
+		{lit: "-0", want: 0},
+		{lit: "18446744073709551616", err: jp.ErrNumberRange},
+		{lit: "-1", err: jp.ErrNumberRange},
+		{lit: "0.5", err: jp.ErrNumberPrecision},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.lit, func(t *testing.T) {
+			got, err := (&jp.Number{Literal: tC.lit}).Uint64()
+			if !errors.Is(err, tC.err) {
+				t.Fatalf("Bad error: got %v, want %v", err, tC.err)
+			}
+			if got != tC.want {
+				t.Fatalf("Bad uint64: got %d, want %d", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestNumberFloat64(t *testing.T) {
+	testCases := []struct {
+		lit  string
+		want float64
+		err  error
+	}{
+		{lit: "0.1", want: 0.1},
+		{lit: "-0.0", want: 0},
+		{lit: "1.50", want: 1.5},
+		{lit: "1e300", want: 1e300},
+		{lit: "9007199254740993", want: 9007199254740992, err: jp.ErrNumberPrecision},
+		{lit: "0.10000000000000000001", want: 0.1, err: jp.ErrNumberPrecision},
+		{lit: "1e400", want: math.Inf(1), err: jp.ErrNumberRange},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.lit, func(t *testing.T) {
+			got, err := (&jp.Number{Literal: tC.lit}).Float64()
+			if !errors.Is(err, tC.err) {
+				t.Fatalf("Bad error: got %v, want %v", err, tC.err)
+			}
+			if got != tC.want {
+				t.Fatalf("Bad float64: got %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestNumberBig(t *testing.T) {
+	n := &jp.Number{Literal: "12345678901234567890.125"}
+
+	r, err := n.Rat()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want, _ := new(big.Rat).SetString("98765431209876543121/8"); r.Cmp(want) != 0 {
+		t.Fatalf("Bad rat: got %v, want %v", r, want)
+	}
+
+	f, err := n.BigFloat(128)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if f.Acc() != big.Exact {
+		t.Fatalf("Bad accuracy: got %v, want %v", f.Acc(), big.Exact)
+	}
+	if f, _ = n.BigFloat(0); f.Acc() == big.Exact {
+		t.Fatalf("Bad accuracy: got %v, want rounded", f.Acc())
+	}
+}
+
+func TestNumberError(t *testing.T) {
+	_, err := (&jp.Number{Literal: "1.5"}).Int64()
+	want := "cannot convert 1.5 to int64: number would lose precision"
+	if err == nil || err.Error() != want {
+		t.Fatalf("Bad error: got %v, want %q", err, want)
+	}
+}
@@ -5,131 +5,298 @@ import (
 	"io"
 )
 
+// Options tunes how a Parser reads its input. The zero value parses strict
+// JSON and stops at the first error.
+type Options struct {
+	// Debug logs every token as it is read.
+	Debug bool
+	// Recover keeps parsing after an error, resynchronising at the next comma
+	// or closing bracket, so that every problem in the input is reported.
+	Recover bool
+	// MaxDepth limits how deeply arrays and objects may nest. Zero means
+	// DefaultMaxDepth and a negative value removes the limit.
+	MaxDepth int
+	// TrackPositions records where each value starts so that problems found
+	// after parsing can still point at the input. See Parser.Positions.
+	TrackPositions bool
+	// Relaxed accepts JSON5: comments, trailing commas, unquoted keys, single
+	// quoted strings and the extended number syntax. Numbers are kept in
+	// their JSON form where they have one.
+	Relaxed bool
+	// Sequence reads any number of values one after another, either simply
+	// concatenated or as an RFC 7464 text sequence with each value preceded
+	// by an RS (0x1E) character. See Parser.Next.
+	Sequence bool
+	// Duplicates says what to do about objects that use the same member name
+	// more than once. The zero value allows them.
+	Duplicates DuplicatePolicy
+	// IJSON rejects anything RFC 7493 doesn't allow in I-JSON: strings that
+	// aren't valid Unicode, numbers a double can't hold exactly, integers
+	// beyond ±(2^53-1) and duplicate keys, whatever Duplicates says.
+	IJSON bool
+}
+
+// duplicates is the duplicate key policy in force.
+func (o Options) duplicates() DuplicatePolicy {
+	if o.IJSON {
+		return RejectDuplicates
+	}
+	return o.Duplicates
+}
+
+const DefaultMaxDepth = 10000
+
+// DuplicatePolicy is what a Parser does about an object member named the same
+// as an earlier one.
+type DuplicatePolicy string
+
+const (
+	// AllowDuplicates keeps every member.
+	AllowDuplicates DuplicatePolicy = "allow"
+	// WarnDuplicates keeps every member but reports each repeat as a warning.
+	WarnDuplicates DuplicatePolicy = "warn"
+	// RejectDuplicates treats a repeated name as an error.
+	RejectDuplicates DuplicatePolicy = "error"
+	// FirstKeyWins keeps only the first member of each name.
+	FirstKeyWins DuplicatePolicy = "first"
+	// LastKeyWins keeps the value of the last member of each name, in the
+	// place of the first.
+	LastKeyWins DuplicatePolicy = "last"
+)
+
+// Positions maps each value of a parsed document to where it starts in the
+// input.
+type Positions map[Value]Position
+
+// Parser builds a document tree from the events read from its input.
 type Parser struct {
-	lx    Lexer
-	tok   Token
-	debug bool
+	events     EventReader
+	positions  Positions
+	sequence   bool
+	duplicates DuplicatePolicy
+	index      int
+	pending    *Event
+	warned     int
 }
 
 func NewParser(src io.Reader) Parser {
-	return NewDebugParser(src, false)
+	return NewParserWithOptions(src, Options{})
 }
 
 func NewDebugParser(src io.Reader, dbg bool) Parser {
-	p := Parser{
-		lx:    NewLexer(src),
-		debug: dbg,
-	}
-
-	p.readToken()
-
-	return p
+	return NewParserWithOptions(src, Options{Debug: dbg})
 }
 
-func (p *Parser) Parse() error {
-	if err := p.parseExpression(); err != nil {
-		return fmt.Errorf("Parse failure: %w", err)
+func NewParserWithOptions(src io.Reader, opts Options) Parser {
+	p := Parser{
+		events:     NewEventReader(src, opts),
+		sequence:   opts.Sequence,
+		duplicates: opts.duplicates(),
 	}
-
-	if p.tok.Type != EOF {
-		return fmt.Errorf("additional top level token: %s", p.tok)
+	if opts.TrackPositions {
+		p.positions = Positions{}
 	}
-
-	return nil
+	return p
 }
 
-func (p *Parser) readToken() {
-	p.tok = p.lx.NextToken()
-	p.log(p.tok.String())
+// Positions says where the values returned by Parse started, if the parser
+// was asked to track them.
+func (p *Parser) Positions() Positions {
+	return p.positions
 }
 
-func (p *Parser) log(msg string) {
-	if p.debug {
-		fmt.Println(msg)
-	}
+// Warnings returns the problems found so far that didn't stop the input being
+// read, such as duplicate keys under WarnDuplicates.
+func (p *Parser) Warnings() ErrorList {
+	return p.events.Warnings()
 }
 
-func (p *Parser) parseExpression() error {
-	var err error
-	switch p.tok.Type {
-	case LBRACE:
-		err = p.parseObject()
-	case LBRCKT:
-		err = p.parseArray()
-	case NULL:
-	case STRING:
-	case NUM:
-	case TRUE, FALSE:
-	default:
-		return fmt.Errorf("invalid expression, unexpected token: %s", p.tok)
+func (p *Parser) track(v Value, tok Token) Value {
+	if p.positions != nil {
+		p.positions[v] = tok.Start
 	}
+	return v
+}
 
-	p.readToken()
+// frame is a container that is still being built. Keeping these on an
+// explicit stack rather than recursing means the depth of document we can
+// handle isn't bounded by the goroutine stack.
+type frame struct {
+	arr    *Array
+	obj    *Object
+	key    string
+	hasKey bool
 
-	return err
+	// members maps names to their place in obj when duplicates are being
+	// resolved, lastWins saying which of them to keep.
+	members  map[string]int
+	lastWins bool
 }
 
-func (p *Parser) parseArray() error {
-	p.readToken()
-	if p.tok.Type == RBRCKT {
-		return nil
-	}
-	if err := p.parseExpression(); err != nil {
-		return fmt.Errorf("bad expression in array: %w", err)
+func (f *frame) value() Value {
+	if f.obj != nil {
+		return f.obj
 	}
+	return f.arr
+}
 
-	for p.tok.Type == COMMA {
-		p.readToken()
-		if err := p.parseExpression(); err != nil {
-			return fmt.Errorf("bad expression in array: %w", err)
+// add puts v into the container. A member whose value couldn't be read in
+// recovery mode leaves a key with nothing to pair it with, which is dropped.
+func (f *frame) add(v Value) {
+	switch {
+	case f.arr != nil:
+		f.arr.Elems = append(f.arr.Elems, v)
+	case f.hasKey:
+		f.hasKey = false
+		if f.members != nil {
+			if i, ok := f.members[f.key]; ok {
+				if f.lastWins {
+					f.obj.Members[i].Value = v
+				}
+				return
+			}
+			f.members[f.key] = len(f.obj.Members)
 		}
+		f.obj.Members = append(f.obj.Members, Member{Key: f.key, Value: v})
 	}
+}
 
-	if p.tok.Type != RBRCKT {
-		return fmt.Errorf("malformed array, expected ']', got '%s'", p.tok)
+// Parse reads a single JSON document, or in sequence mode the next value,
+// returning io.EOF once there are none left. In recovery mode the returned
+// error is an ErrorList holding every problem found and the value is whatever
+// could be salvaged from the document.
+func (p *Parser) Parse() (Value, error) {
+	seen := len(p.events.Errors())
+	root, _, err := p.read(seen)
+	if err == nil && !p.sequence {
+		// Make sure nothing follows the document.
+		_, _, err = p.read(0)
+	}
+	if err == io.EOF && p.sequence && len(p.events.Errors()) == seen {
+		return nil, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Parse failure: %w", err)
 	}
 
-	return nil
+	if errs := p.events.Errors()[seen:]; len(errs) > 0 {
+		return root, errs
+	}
+	return root, nil
 }
 
-func (p *Parser) parseObject() error {
-	p.readToken()
-	if p.tok.Type == RBRACE {
-		return nil
+// Next reads the next value of a sequence, returning io.EOF once there are
+// none left. In recovery mode problems with the value are reported in the
+// record's Err, along with whatever could be salvaged of it, and reading
+// carries on with the next value. Anything between values that couldn't be
+// read is reported as a record of its own.
+func (p *Parser) Next() (Record, error) {
+	seen := len(p.events.Errors())
+	v, start, err := p.read(seen)
+	if err == io.EOF && len(p.events.Errors()) > seen {
+		err = nil
+	}
+	if err == io.EOF {
+		return Record{}, err
 	}
-
-	err := p.readKV()
 	if err != nil {
-		return fmt.Errorf("failed to read object key/value: %w", err)
+		return Record{}, fmt.Errorf("Parse failure: %w", err)
 	}
 
-	for p.tok.Type == COMMA {
-		p.readToken()
-		err := p.readKV()
-		if err != nil {
-			return fmt.Errorf("failed to read object key/value: %w", err)
+	rec := Record{Index: p.index, Line: start.Line, Value: v}
+	if warnings := p.events.Warnings()[p.warned:]; len(warnings) > 0 {
+		rec.Warnings = warnings
+		p.warned += len(warnings)
+	}
+	if errs := p.events.Errors()[seen:]; len(errs) > 0 {
+		rec.Err = errs
+		if v == nil {
+			rec.Line = errs[0].Pos.Line
 		}
 	}
+	p.index++
+	return rec, nil
+}
 
-	if p.tok.Type != RBRACE {
-		return fmt.Errorf("malformed object, expected '}', got '%s'", p.tok)
+// read builds the next top level value from the events, returning where it
+// started or io.EOF if there are none left. In a sequence, finding that more
+// than seen errors have been recorded before a value starts means something
+// between values was skipped, which is returned on its own as a nil value.
+func (p *Parser) read(seen int) (Value, Position, error) {
+	var root Value
+	var start Position
+	var stack []*frame
+	add := func(v Value) {
+		if len(stack) == 0 {
+			root = v
+			return
+		}
+		stack[len(stack)-1].add(v)
 	}
 
-	return nil
-}
+	for {
+		ev, err := p.nextEvent()
+		if err != nil {
+			return nil, start, err
+		}
+		if len(stack) == 0 {
+			if p.sequence && len(p.events.Errors()) > seen {
+				p.pending = &ev
+				return nil, start, nil
+			}
+			start = ev.Token.Start
+		}
 
-func (p *Parser) readKV() error {
-	if p.tok.Type != STRING {
-		return fmt.Errorf("expected key string in object found %s", p.tok)
-	}
-	p.readToken()
-	if p.tok.Type != COLON {
-		return fmt.Errorf("expected ':' in object found %s", p.tok)
+		switch ev.Type {
+		case StartObject:
+			obj := &Object{Members: []Member{}}
+			p.track(obj, ev.Token)
+			f := &frame{obj: obj}
+			if p.duplicates == FirstKeyWins || p.duplicates == LastKeyWins {
+				f.members = map[string]int{}
+				f.lastWins = p.duplicates == LastKeyWins
+			}
+			stack = append(stack, f)
+		case StartArray:
+			arr := &Array{Elems: []Value{}}
+			p.track(arr, ev.Token)
+			stack = append(stack, &frame{arr: arr})
+		case Key:
+			top := stack[len(stack)-1]
+			top.key, top.hasKey = ev.Token.Value, true
+		case Scalar:
+			add(p.track(scalarValue(ev.Token), ev.Token))
+		case End:
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			add(top.value())
+		}
+
+		if len(stack) == 0 {
+			return root, start, nil
+		}
 	}
-	p.readToken()
-	if err := p.parseExpression(); err != nil {
-		return fmt.Errorf("bad expression in object: %w", err)
+}
+
+func (p *Parser) nextEvent() (Event, error) {
+	if ev := p.pending; ev != nil {
+		p.pending = nil
+		return *ev, nil
 	}
+	return p.events.Next()
+}
 
-	return nil
+func scalarValue(tok Token) Value {
+	switch tok.Type {
+	case STRING:
+		return &String{Value: tok.Value}
+	case NUM:
+		if tok.Value != "" {
+			return &Number{Literal: tok.Value}
+		}
+		return &Number{Literal: tok.Literal}
+	case TRUE, FALSE:
+		return &Bool{Value: tok.Type == TRUE}
+	}
+	return &Null{}
 }
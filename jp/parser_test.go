@@ -1,6 +1,9 @@
 package main_test
 
 import (
+	"errors"
+	"io"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -23,7 +26,7 @@ func TestParseMinimal(t *testing.T) {
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
 			p := jp.NewParser(strings.NewReader(tC.data))
-			if err := p.Parse(); err != nil {
+			if _, err := p.Parse(); err != nil {
 				t.Fatalf("Unexpected parse error: %v", err)
 			}
 		})
@@ -44,7 +47,7 @@ func TestParseArray(t *testing.T) {
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
 			p := jp.NewParser(strings.NewReader(tC.data))
-			if err := p.Parse(); err != nil {
+			if _, err := p.Parse(); err != nil {
 				t.Fatalf("Unexpected parse error: %v", err)
 			}
 		})
@@ -68,7 +71,7 @@ func TestParseObject(t *testing.T) {
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
 			p := jp.NewParser(strings.NewReader(tC.data))
-			if err := p.Parse(); err != nil {
+			if _, err := p.Parse(); err != nil {
 				t.Fatalf("Unexpected parse error: %v", err)
 			}
 		})
@@ -84,18 +87,18 @@ func TestBadJson(t *testing.T) {
 		{
 			desc: "Unterminated array",
 			data: "[1,2",
-			err:  "Parse failure: malformed array, expected ']'",
+			err:  "Parse failure: malformed array, expected ',' or ']'",
 		},
 		{
 			desc: "Unterminated object",
 			data: `{ "k":"v" `,
-			err:  "Parse failure: malformed object, expected '}'",
+			err:  "Parse failure: malformed object, expected ',' or '}'",
 		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
 			p := jp.NewParser(strings.NewReader(tC.data))
-			err := p.Parse()
+			_, err := p.Parse()
 			if err == nil {
 				t.Fatalf("Got no error, wanted: %s", err)
 			}
@@ -105,3 +108,650 @@ func TestBadJson(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTree(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		want jp.Value
+	}{
+		{desc: "null", data: "null", want: &jp.Null{}},
+		{desc: "true", data: "true", want: &jp.Bool{Value: true}},
+		{desc: "false", data: "false", want: &jp.Bool{Value: false}},
+		{desc: "number", data: "-1.5e3", want: &jp.Number{Literal: "-1.5e3"}},
+		{desc: "string", data: `"bacon"`, want: &jp.String{Value: "bacon"}},
+		{desc: "escaped string", data: `"a\tb\u00e9"`, want: &jp.String{Value: "a\tbé"}},
+		{
+			desc: "escaped key",
+			data: `{"\u0041\n": 1}`,
+			want: &jp.Object{Members: []jp.Member{
+				{Key: "A\n", Value: &jp.Number{Literal: "1"}},
+			}},
+		},
+		{desc: "empty array", data: "[]", want: &jp.Array{Elems: []jp.Value{}}},
+		{desc: "empty object", data: "{}", want: &jp.Object{Members: []jp.Member{}}},
+		{
+			desc: "array",
+			data: `[1, "a", [null]]`,
+			want: &jp.Array{Elems: []jp.Value{
+				&jp.Number{Literal: "1"},
+				&jp.String{Value: "a"},
+				&jp.Array{Elems: []jp.Value{&jp.Null{}}},
+			}},
+		},
+		{
+			desc: "object keeps key order",
+			data: `{"z": 1, "a": {"m": true}, "k": []}`,
+			want: &jp.Object{Members: []jp.Member{
+				{Key: "z", Value: &jp.Number{Literal: "1"}},
+				{Key: "a", Value: &jp.Object{Members: []jp.Member{
+					{Key: "m", Value: &jp.Bool{Value: true}},
+				}}},
+				{Key: "k", Value: &jp.Array{Elems: []jp.Value{}}},
+			}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParser(strings.NewReader(tC.data))
+			got, err := p.Parse()
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("Bad tree: got %#v, want %#v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestParseRelaxed(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		want string
+	}{
+		{desc: "comments", data: "// head\n[1, /* two */ 2] // tail", want: `[1,2]`},
+		{desc: "trailing commas", data: `{"a": [1, 2,], "b": {},}`, want: `{"a":[1,2],"b":{}}`},
+		{desc: "identifier keys", data: `{name: 1, $id: 2, _x9: 3, true: 4, NaN: 5}`, want: `{"name":1,"$id":2,"_x9":3,"true":4,"NaN":5}`},
+		{desc: "single quotes", data: `{'a': 'it\'s "quoted"'}`, want: `{"a":"it's \"quoted\""}`},
+		{desc: "numbers", data: `[0x1F, .5, 5., +1, -0x1]`, want: `[31,0.5,5,1,-1]`},
+		{desc: "multi-line string", data: "'one \\\ntwo'", want: `"one two"`},
+		{desc: "whitespace", data: "\ufeff\v[\u00a01\u2028]", want: `[1]`},
+		{desc: "plain JSON", data: `{"a": [true, null]}`, want: `{"a":[true,null]}`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(tC.data), jp.Options{Relaxed: true})
+			got, err := p.Parse()
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			if s := jp.FormatString(got, jp.FormatOptions{}); s != tC.want {
+				t.Fatalf("Bad tree: got %s, want %s", s, tC.want)
+			}
+
+			p = jp.NewParser(strings.NewReader(tC.data))
+			if _, err := p.Parse(); err == nil && tC.desc != "plain JSON" {
+				t.Fatalf("Got nil but wanted error without relaxed mode")
+			}
+		})
+	}
+}
+
+func TestBadRelaxed(t *testing.T) {
+	testCases := []string{
+		`[,]`,
+		`{,}`,
+		`[1,,]`,
+		`{a: 1,,}`,
+		`{a b: 1}`,
+		`{1: 2}`,
+		`{'a' 1}`,
+		`[1] /* open`,
+		`[1] / 2`,
+	}
+	for _, tC := range testCases {
+		t.Run(tC, func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(tC), jp.Options{Relaxed: true})
+			if _, err := p.Parse(); err == nil {
+				t.Fatalf("Got nil but wanted error")
+			}
+		})
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		err  string
+	}{
+		{
+			desc: "unterminated array",
+			data: "[1,2",
+			err:  "malformed array, expected ',' or ']', got end of input at line 1, column 5\n  [1,2\n      ^",
+		},
+		{
+			desc: "bad token on later line",
+			data: "{\n\t\"a\": 1,\n\t\"b\": tru\n}",
+			err:  "invalid expression, expected '{', '[', STRING, NUM, TRUE, FALSE or NULL, got IDENT(tru) at line 3, column 7\n  \t\"b\": tru\n  \t     ^",
+		},
+		{
+			desc: "bad character inside string",
+			data: `["ok", "bad \escape"]`,
+			err:  "bad string: invalid escape sequence '\\e' at line 1, column 14\n  [\"ok\", \"bad \\escape\"]\n               ^",
+		},
+		{
+			desc: "trailing token",
+			data: "{} []",
+			err:  "additional top level token, expected end of input, got '[' at line 1, column 4\n  {} []\n     ^",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParser(strings.NewReader(tC.data))
+			_, err := p.Parse()
+			if err == nil {
+				t.Fatalf("Got no error, wanted: %s", tC.err)
+			}
+			if !strings.HasSuffix(err.Error(), tC.err) {
+				t.Fatalf("Wrong error, got\n%s\nwant\n%s", err, tC.err)
+			}
+		})
+	}
+}
+
+func TestErrorCauses(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		want error
+	}{
+		{desc: "unexpected eof", data: "[1,2", want: jp.ErrUnexpectedEOF},
+		{desc: "unexpected token", data: "[1 2]", want: jp.ErrUnexpectedToken},
+		{desc: "trailing data", data: "{} []", want: jp.ErrTrailingData},
+		{desc: "unrecognised token", data: "[@]", want: jp.ErrUnrecognisedToken},
+		{desc: "unterminated string", data: `{"a": "b`, want: jp.ErrUnterminatedString},
+		{desc: "invalid escape", data: `["\x"]`, want: jp.ErrInvalidEscape},
+		{desc: "invalid unicode", data: `["\u00g0"]`, want: jp.ErrInvalidUnicode},
+		{desc: "control character", data: "[\"\t\"]", want: jp.ErrControlChar},
+		{desc: "leading zero", data: "[01]", want: jp.ErrLeadingZero},
+		{desc: "invalid number", data: "[1.]", want: jp.ErrInvalidNumber},
+		{desc: "trailing bad token", data: "{} 01", want: jp.ErrLeadingZero},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParser(strings.NewReader(tC.data))
+			_, err := p.Parse()
+			if !errors.Is(err, tC.want) {
+				t.Fatalf("Wrong cause, got %v, want %v", err, tC.want)
+			}
+			var perr *jp.ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Error is not a ParseError: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseErrorDetail(t *testing.T) {
+	p := jp.NewParser(strings.NewReader("{\"a\": 1 \"b\": 2}"))
+	_, err := p.Parse()
+
+	var perr *jp.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Error is not a ParseError: %v", err)
+	}
+	if want := (jp.Position{Offset: 8, Line: 1, Col: 9}); perr.Pos != want {
+		t.Fatalf("Wrong position: got %+v, want %+v", perr.Pos, want)
+	}
+	if perr.Found.Type != jp.STRING || perr.Found.Value != "b" {
+		t.Fatalf("Wrong token found: got %s", perr.Found)
+	}
+	if want := []jp.TokenType{jp.COMMA, jp.RBRACE}; !reflect.DeepEqual(perr.Expected, want) {
+		t.Fatalf("Wrong expected tokens: got %v, want %v", perr.Expected, want)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		errs []string
+		want jp.Value
+	}{
+		{
+			desc: "valid document",
+			data: `[1, {"a": true}]`,
+			want: &jp.Array{Elems: []jp.Value{
+				&jp.Number{Literal: "1"},
+				&jp.Object{Members: []jp.Member{{Key: "a", Value: &jp.Bool{Value: true}}}},
+			}},
+		},
+		{
+			desc: "bad elements",
+			data: `[1, tru, 3 4, "\q", 5,]`,
+			errs: []string{
+				"invalid expression, expected '{', '[', STRING, NUM, TRUE, FALSE or NULL, got IDENT(tru)",
+				"malformed array, expected ',' or ']', got NUM(4)",
+				"bad string: invalid escape sequence '\\q'",
+				"invalid expression, expected '{', '[', STRING, NUM, TRUE, FALSE or NULL, got ']'",
+			},
+			want: &jp.Array{Elems: []jp.Value{
+				&jp.Number{Literal: "1"},
+				&jp.Number{Literal: "3"},
+				&jp.Number{Literal: "5"},
+			}},
+		},
+		{
+			desc: "bad members",
+			data: `{"a" 1, b: 2, "c": [1 [2, 3], 4], "d": null}`,
+			errs: []string{
+				"malformed object member, expected ':', got NUM(1)",
+				"malformed object key, expected STRING, got IDENT(b)",
+				"malformed array, expected ',' or ']', got '['",
+			},
+			want: &jp.Object{Members: []jp.Member{
+				{Key: "c", Value: &jp.Array{Elems: []jp.Value{
+					&jp.Number{Literal: "1"},
+					&jp.Number{Literal: "4"},
+				}}},
+				{Key: "d", Value: &jp.Null{}},
+			}},
+		},
+		{
+			desc: "truncated input reported once",
+			data: `{"a": [1, {"b": [`,
+			errs: []string{
+				"invalid expression, expected '{', '[', STRING, NUM, TRUE, FALSE or NULL, got end of input",
+			},
+			want: &jp.Object{Members: []jp.Member{
+				{Key: "a", Value: &jp.Array{Elems: []jp.Value{
+					&jp.Number{Literal: "1"},
+					&jp.Object{Members: []jp.Member{
+						{Key: "b", Value: &jp.Array{Elems: []jp.Value{}}},
+					}},
+				}}},
+			}},
+		},
+		{
+			desc: "trailing data",
+			data: `[] {} x`,
+			errs: []string{
+				"additional top level token, expected end of input, got '{'",
+			},
+			want: &jp.Array{Elems: []jp.Value{}},
+		},
+		{
+			desc: "no value",
+			data: `}`,
+			errs: []string{
+				"invalid expression, expected '{', '[', STRING, NUM, TRUE, FALSE or NULL, got '}'",
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(tC.data), jp.Options{Recover: true})
+			got, err := p.Parse()
+
+			var errs jp.ErrorList
+			if len(tC.errs) == 0 && err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			if len(tC.errs) > 0 && !errors.As(err, &errs) {
+				t.Fatalf("Error is not an ErrorList: %v", err)
+			}
+			if len(errs) != len(tC.errs) {
+				t.Fatalf("Wrong number of errors, got %d, want %d: %v", len(errs), len(tC.errs), err)
+			}
+			for i, e := range errs {
+				if !strings.HasPrefix(e.Error(), tC.errs[i]) {
+					t.Fatalf("Wrong error %d, got '%s', want '%s'", i, e, tC.errs[i])
+				}
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("Bad tree: got %#v, want %#v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		data  string
+		limit int
+		err   error
+	}{
+		{desc: "within limit", data: "[[{}]]", limit: 3},
+		{desc: "array too deep", data: "[[[[]]]]", limit: 3, err: jp.ErrMaxDepth},
+		{desc: "object too deep", data: `{"a":{"b":{"c":{}}}}`, limit: 3, err: jp.ErrMaxDepth},
+		{
+			desc: "default limit",
+			data: strings.Repeat("[", jp.DefaultMaxDepth+1),
+			err:  jp.ErrMaxDepth,
+		},
+		{
+			desc: "huge input",
+			data: strings.Repeat("[", 1_000_000),
+			err:  jp.ErrMaxDepth,
+		},
+		{
+			desc:  "no limit",
+			data:  strings.Repeat("[", 100_000) + strings.Repeat("]", 100_000),
+			limit: -1,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(tC.data), jp.Options{MaxDepth: tC.limit})
+			_, err := p.Parse()
+			if tC.err == nil && err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			if !errors.Is(err, tC.err) {
+				t.Fatalf("Wrong error, got %v, want %v", err, tC.err)
+			}
+		})
+	}
+}
+
+func TestMaxDepthRecover(t *testing.T) {
+	data := `[1, [[[2]]], 3]`
+	p := jp.NewParserWithOptions(strings.NewReader(data), jp.Options{Recover: true, MaxDepth: 2})
+	got, err := p.Parse()
+
+	var errs jp.ErrorList
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(errs[0], jp.ErrMaxDepth) {
+		t.Fatalf("Wrong errors: %v", err)
+	}
+	want := &jp.Array{Elems: []jp.Value{
+		&jp.Number{Literal: "1"},
+		&jp.Array{Elems: []jp.Value{}},
+		&jp.Number{Literal: "3"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bad tree: got %#v, want %#v", got, want)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	type want struct {
+		index, line int
+		doc         string
+		bad         bool
+	}
+	testCases := []struct {
+		desc string
+		data string
+		want []want
+	}{
+		{
+			desc: "concatenated",
+			data: "{}{\"a\":1}[]\n1 2 \"x\"",
+			want: []want{
+				{index: 0, line: 1, doc: `{}`},
+				{index: 1, line: 1, doc: `{"a":1}`},
+				{index: 2, line: 1, doc: `[]`},
+				{index: 3, line: 2, doc: `1`},
+				{index: 4, line: 2, doc: `2`},
+				{index: 5, line: 2, doc: `"x"`},
+			},
+		},
+		{
+			desc: "text sequence",
+			data: "\x1e{\"a\":1}\n\x1e\x1e[2]\n\x1e",
+			want: []want{
+				{index: 0, line: 1, doc: `{"a":1}`},
+				{index: 1, line: 2, doc: `[2]`},
+			},
+		},
+		{
+			desc: "truncated text",
+			data: "\x1e{\"a\": [1,\n\x1e[2]\n",
+			want: []want{
+				{index: 0, line: 1, doc: `{"a":[1]}`, bad: true},
+				{index: 1, line: 2, doc: `[2]`},
+			},
+		},
+		{
+			desc: "junk between values",
+			data: "{} nope ]\n{\"x\":1} oops",
+			want: []want{
+				{index: 0, line: 1, doc: `{}`},
+				{index: 1, line: 1, bad: true},
+				{index: 2, line: 2, doc: `{"x":1}`},
+				{index: 3, line: 2, bad: true},
+			},
+		},
+		{
+			desc: "empty",
+			data: " \n",
+			want: []want{},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(tC.data), jp.Options{Sequence: true, Recover: true})
+			var got []want
+			for {
+				rec, err := p.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				w := want{index: rec.Index, line: rec.Line, bad: rec.Err != nil}
+				if rec.Value != nil {
+					w.doc = jp.FormatString(rec.Value, jp.FormatOptions{})
+				}
+				got = append(got, w)
+			}
+			if len(got) != len(tC.want) || len(got) > 0 && !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("Bad records: got %+v, want %+v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestParseSequence(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		data    string
+		recover bool
+		want    []string
+	}{
+		{desc: "text sequence", data: "\x1e{\"a\":1}\n\x1e[2]\n", want: []string{`{"a":1}`, `[2]`}},
+		{desc: "concatenated", data: `1 "x" null`, want: []string{`1`, `"x"`, `null`}},
+		{desc: "recovering", data: "\x1e[1]\n\x1e[2]\n", recover: true, want: []string{`[1]`, `[2]`}},
+		{desc: "empty", data: " \n", want: []string{}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(tC.data), jp.Options{Sequence: true, Recover: tC.recover})
+			got := []string{}
+			for {
+				v, err := p.Parse()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				got = append(got, jp.FormatString(v, jp.FormatOptions{}))
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("Bad values: got %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestParseSequenceErrors(t *testing.T) {
+	p := jp.NewParserWithOptions(strings.NewReader("[1] [2,] [3]"), jp.Options{Sequence: true, Recover: true})
+	for i, wantErr := range []bool{false, true, false} {
+		_, err := p.Parse()
+		if (err != nil) != wantErr {
+			t.Fatalf("Bad error for value %d: got %v, want error %t", i, err, wantErr)
+		}
+	}
+	if _, err := p.Parse(); err != io.EOF {
+		t.Fatalf("Bad error: got %v, want %v", err, io.EOF)
+	}
+}
+
+func TestSequenceStops(t *testing.T) {
+	p := jp.NewParserWithOptions(strings.NewReader(`[1] [2,] [3]`), jp.Options{Sequence: true})
+	if rec, err := p.Next(); err != nil || rec.Index != 0 {
+		t.Fatalf("Bad first record: got %+v, %v", rec, err)
+	}
+	if _, err := p.Next(); !errors.Is(err, jp.ErrUnexpectedToken) {
+		t.Fatalf("Bad error: got %v, want %v", err, jp.ErrUnexpectedToken)
+	}
+}
+
+func TestSequenceNeedsOption(t *testing.T) {
+	p := jp.NewParser(strings.NewReader("\x1e[1]"))
+	if _, err := p.Parse(); !errors.Is(err, jp.ErrUnrecognisedToken) {
+		t.Fatalf("Bad error: got %v, want %v", err, jp.ErrUnrecognisedToken)
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	data := "{\"a\": 1, \"b\": {\"x\": 1, \"x\": 2},\n \"a\": 3}"
+	testCases := []struct {
+		policy   jp.DuplicatePolicy
+		want     string
+		warnings int
+		errors   int
+	}{
+		{policy: "", want: `{"a":1,"b":{"x":1,"x":2},"a":3}`},
+		{policy: jp.AllowDuplicates, want: `{"a":1,"b":{"x":1,"x":2},"a":3}`},
+		{policy: jp.WarnDuplicates, want: `{"a":1,"b":{"x":1,"x":2},"a":3}`, warnings: 2},
+		{policy: jp.RejectDuplicates, want: `{"a":1,"b":{"x":1,"x":2},"a":3}`, errors: 2},
+		{policy: jp.FirstKeyWins, want: `{"a":1,"b":{"x":1}}`},
+		{policy: jp.LastKeyWins, want: `{"a":3,"b":{"x":2}}`},
+	}
+	for _, tC := range testCases {
+		t.Run(string(tC.policy), func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(data), jp.Options{Duplicates: tC.policy, Recover: true})
+			got, err := p.Parse()
+			var errs jp.ErrorList
+			errors.As(err, &errs)
+			if len(errs) != tC.errors {
+				t.Fatalf("Bad error count: got %d (%v), want %d", len(errs), err, tC.errors)
+			}
+			if len(p.Warnings()) != tC.warnings {
+				t.Fatalf("Bad warning count: got %d, want %d", len(p.Warnings()), tC.warnings)
+			}
+			if s := jp.FormatString(got, jp.FormatOptions{}); s != tC.want {
+				t.Fatalf("Bad tree: got %s, want %s", s, tC.want)
+			}
+		})
+	}
+}
+
+func TestDuplicateKeyError(t *testing.T) {
+	p := jp.NewParserWithOptions(strings.NewReader("{\"a\": 1,\n \"a\": 2}"), jp.Options{Duplicates: jp.RejectDuplicates})
+	_, err := p.Parse()
+	if !errors.Is(err, jp.ErrDuplicateKey) {
+		t.Fatalf("Bad error: got %v, want %v", err, jp.ErrDuplicateKey)
+	}
+
+	var perr *jp.ParseError
+	var dup *jp.DuplicateKeyError
+	if !errors.As(err, &perr) || !errors.As(err, &dup) {
+		t.Fatalf("Bad error: got %T, want a ParseError caused by a DuplicateKeyError", err)
+	}
+	if want := (jp.Position{Offset: 10, Line: 2, Col: 2}); perr.Pos != want {
+		t.Fatalf("Bad position: got %+v, want %+v", perr.Pos, want)
+	}
+	if want := (jp.Position{Offset: 1, Line: 1, Col: 2}); dup.Key != "a" || dup.First != want {
+		t.Fatalf("Bad duplicate: got %q %+v, want \"a\" %+v", dup.Key, dup.First, want)
+	}
+	want := `duplicate key "a" first defined at line 1, column 2 and again at line 2, column 2`
+	if !strings.HasPrefix(perr.Error(), want) {
+		t.Fatalf("Bad message: got %q, want %q", perr.Error(), want)
+	}
+}
+
+func TestDuplicateKeyWarningsPerRecord(t *testing.T) {
+	p := jp.NewParserWithOptions(strings.NewReader(`{"a":1} {"a":1,"a":2} {"a":1}`), jp.Options{Sequence: true, Duplicates: jp.WarnDuplicates})
+	for i, want := range []int{0, 1, 0} {
+		rec, err := p.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(rec.Warnings) != want {
+			t.Fatalf("Bad warnings for record %d: got %d, want %d", i, len(rec.Warnings), want)
+		}
+	}
+}
+
+func TestIJSON(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		err  string
+	}{
+		{desc: "large integer", data: `[9007199254740992]`, err: "integer is outside the range ±(2^53-1)"},
+		{desc: "large negative integer", data: `-9007199254740992`, err: "integer is outside the range ±(2^53-1)"},
+		{desc: "large exponent", data: `1e300`, err: "integer is outside the range ±(2^53-1)"},
+		{desc: "just past the range", data: `9007199254740993`, err: "integer is outside the range ±(2^53-1)"},
+		{desc: "larger than int64", data: `12345678901234567891`, err: "integer is outside the range ±(2^53-1)"},
+		{desc: "too large", data: `1e400`, err: "number is too large for a double"},
+		{desc: "too precise", data: `0.10000000000000000001`, err: "number is more precise than a double"},
+		{desc: "overlong UTF-8", data: "\"\xc0\xaf\"", err: "non-shortest form UTF-8 in string"},
+		{desc: "overlong three byte UTF-8", data: "\"\xe0\x80\xaf\"", err: "non-shortest form UTF-8 in string"},
+		{desc: "invalid UTF-8", data: "\"\xff\"", err: "invalid UTF-8 in string"},
+		{desc: "unpaired surrogate", data: `"\ud800"`, err: `unpaired surrogate \ud800 in string`},
+		{desc: "lone low surrogate", data: `"\udc00\ud800"`, err: `unpaired surrogate \udc00 in string`},
+		{desc: "noncharacter", data: "\"﷐\"", err: "noncharacter U+FDD0 in string"},
+		{desc: "escaped noncharacter", data: `"\uffff"`, err: "noncharacter U+FFFF in string"},
+		{desc: "duplicate key", data: `{"a": 1, "a": 2}`, err: `duplicate key "a"`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(tC.data), jp.Options{IJSON: true, Duplicates: jp.AllowDuplicates})
+			_, err := p.Parse()
+			if !errors.Is(err, jp.ErrIJSON) && !errors.Is(err, jp.ErrDuplicateKey) {
+				t.Fatalf("Bad error: got %v, want an I-JSON error", err)
+			}
+			if !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("Bad message: got %q, want %q", err.Error(), tC.err)
+			}
+		})
+	}
+}
+
+func TestIJSONAccepts(t *testing.T) {
+	testCases := []string{
+		`[9007199254740991, -9007199254740991]`,
+		`[0.1, 1.5e-300, 2.50, -0]`,
+		`"😀 😀"`,
+		`{"a": 1, "b": {"a": 2}}`,
+	}
+	for _, tC := range testCases {
+		t.Run(tC, func(t *testing.T) {
+			p := jp.NewParserWithOptions(strings.NewReader(tC), jp.Options{IJSON: true})
+			if _, err := p.Parse(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestIJSONRecover(t *testing.T) {
+	p := jp.NewParserWithOptions(strings.NewReader(`[1e400, 2, 9007199254740993]`), jp.Options{IJSON: true, Recover: true})
+	doc, err := p.Parse()
+	var errs jp.ErrorList
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Bad errors: got %v, want 2", err)
+	}
+	if arr, ok := doc.(*jp.Array); !ok || len(arr.Elems) != 3 {
+		t.Fatalf("Bad document: got %v, want all three numbers", doc)
+	}
+}
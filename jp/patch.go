@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid JSON patch")
+	ErrTestFailed   = errors.New("test failed")
+)
+
+// Operation is a single step of an RFC 6902 JSON Patch. From is only used by
+// move and copy, Value only by add, replace and test.
+type Operation struct {
+	Op    string
+	Path  Pointer
+	From  Pointer
+	Value Value
+}
+
+// Patch is a sequence of operations applied in order.
+type Patch []Operation
+
+// PatchError says which operation of a patch went wrong.
+type PatchError struct {
+	Index int
+	Op    string
+	Err   error
+}
+
+func (e *PatchError) Error() string {
+	if e.Op == "" {
+		return fmt.Sprintf("operation %d: %s", e.Index, e.Err)
+	}
+	return fmt.Sprintf("operation %d (%s): %s", e.Index, e.Op, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// ParsePatch reads a patch from its JSON form, an array of operation
+// objects.
+func ParsePatch(doc Value) (Patch, error) {
+	arr, ok := doc.(*Array)
+	if !ok {
+		return nil, fmt.Errorf("%w: a patch must be an array of operations, got %s", ErrInvalidPatch, doc.Kind())
+	}
+
+	patch := make(Patch, 0, len(arr.Elems))
+	for i, e := range arr.Elems {
+		op, err := parseOperation(e)
+		if err != nil {
+			return nil, &PatchError{Index: i, Op: op.Op, Err: err}
+		}
+		patch = append(patch, op)
+	}
+	return patch, nil
+}
+
+func parseOperation(v Value) (Operation, error) {
+	var op Operation
+	obj, ok := v.(*Object)
+	if !ok {
+		return op, fmt.Errorf("%w: an operation must be an object, got %s", ErrInvalidPatch, v.Kind())
+	}
+
+	var err error
+	if op.Op, err = stringMember(obj, "op"); err != nil {
+		return op, err
+	}
+	if op.Path, err = pointerMember(obj, "path"); err != nil {
+		return op, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		var ok bool
+		if op.Value, ok = obj.Get("value"); !ok {
+			return op, fmt.Errorf(`%w: missing "value"`, ErrInvalidPatch)
+		}
+	case "move", "copy":
+		if op.From, err = pointerMember(obj, "from"); err != nil {
+			return op, err
+		}
+	case "remove":
+	default:
+		return op, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+
+	return op, nil
+}
+
+func stringMember(obj *Object, key string) (string, error) {
+	v, ok := obj.Get(key)
+	if !ok {
+		return "", fmt.Errorf("%w: missing %q", ErrInvalidPatch, key)
+	}
+	s, ok := v.(*String)
+	if !ok {
+		return "", fmt.Errorf("%w: %q must be a string, got %s", ErrInvalidPatch, key, v.Kind())
+	}
+	return s.Value, nil
+}
+
+func pointerMember(obj *Object, key string) (Pointer, error) {
+	s, err := stringMember(obj, key)
+	if err != nil {
+		return nil, err
+	}
+	ptr, err := ParsePointer(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+	return ptr, nil
+}
+
+// Apply runs the patch against a copy of doc and returns the result. Patches
+// are atomic: if any operation fails the error says which one and doc is left
+// as it was.
+func (p Patch) Apply(doc Value) (Value, error) {
+	doc = Clone(doc)
+	for i, op := range p {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, &PatchError{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	return doc, nil
+}
+
+func (op Operation) apply(doc Value) (Value, error) {
+	switch op.Op {
+	case "add":
+		return add(doc, op.Path, Clone(op.Value))
+	case "remove":
+		_, doc, err := remove(doc, op.Path)
+		return doc, err
+	case "replace":
+		return replace(doc, op.Path, Clone(op.Value))
+	case "move":
+		if slices.Equal(op.From, op.Path) {
+			_, err := op.From.Resolve(doc)
+			return doc, err
+		}
+		if len(op.From) < len(op.Path) && slices.Equal(op.From, op.Path[:len(op.From)]) {
+			return doc, fmt.Errorf("cannot move %q into one of its own children", op.From.String())
+		}
+		v, doc, err := remove(doc, op.From)
+		if err != nil {
+			return doc, err
+		}
+		return add(doc, op.Path, v)
+	case "copy":
+		v, err := op.From.Resolve(doc)
+		if err != nil {
+			return doc, err
+		}
+		return add(doc, op.Path, Clone(v))
+	case "test":
+		v, err := op.Path.Resolve(doc)
+		if err != nil {
+			return doc, err
+		}
+		if !Equal(v, op.Value) {
+			return doc, fmt.Errorf(
+				"%w: %q is %s, want %s",
+				ErrTestFailed,
+				op.Path.String(),
+				FormatString(v, FormatOptions{}),
+				FormatString(op.Value, FormatOptions{}),
+			)
+		}
+		return doc, nil
+	}
+	return doc, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+}
+
+// add puts v at path, replacing the whole document if path is empty.
+func add(doc Value, path Pointer, v Value) (Value, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	last := len(path) - 1
+	parent, err := path.resolve(doc, last)
+	if err != nil {
+		return doc, err
+	}
+
+	switch parent := parent.(type) {
+	case *Object:
+		parent.Set(path[last], v)
+	case *Array:
+		i, err := path.index(parent, last, true)
+		if err != nil {
+			return doc, err
+		}
+		parent.Elems = slices.Insert(parent.Elems, i, v)
+	default:
+		return doc, &PointerError{path, last, fmt.Sprintf("cannot add a member to a %s", parent.Kind())}
+	}
+	return doc, nil
+}
+
+// replace swaps the value at path for v, leaving it where it was.
+func replace(doc Value, path Pointer, v Value) (Value, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	last := len(path) - 1
+	parent, err := path.resolve(doc, last)
+	if err != nil {
+		return doc, err
+	}
+	if _, err := path.step(parent, last); err != nil {
+		return doc, err
+	}
+
+	switch parent := parent.(type) {
+	case *Object:
+		parent.Set(path[last], v)
+	case *Array:
+		i, _ := path.index(parent, last, false)
+		parent.Elems[i] = v
+	}
+	return doc, nil
+}
+
+// remove takes the value at path out of the document, returning it. The
+// whole document can't be removed as that would leave nothing behind.
+func remove(doc Value, path Pointer) (Value, Value, error) {
+	if len(path) == 0 {
+		return nil, doc, errors.New("cannot remove the whole document")
+	}
+	last := len(path) - 1
+	parent, err := path.resolve(doc, last)
+	if err != nil {
+		return nil, doc, err
+	}
+	v, err := path.step(parent, last)
+	if err != nil {
+		return nil, doc, err
+	}
+
+	switch parent := parent.(type) {
+	case *Object:
+		parent.Delete(path[last])
+	case *Array:
+		i, _ := path.index(parent, last, false)
+		parent.Elems = slices.Delete(parent.Elems, i, i+1)
+	}
+	return v, doc, nil
+}
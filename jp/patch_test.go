@@ -0,0 +1,246 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestApplyPatch(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			desc:  "add member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			desc:  "add element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			desc:  "append element",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			desc:  "add replaces existing member",
+			doc:   `{"foo": 1, "bar": 2}`,
+			patch: `[{"op": "add", "path": "/foo", "value": 3}]`,
+			want:  `{"foo":3,"bar":2}`,
+		},
+		{
+			desc:  "add whole document",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "add", "path": "", "value": [1]}]`,
+			want:  `[1]`,
+		},
+		{
+			desc:  "remove member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			desc:  "remove element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			desc:  "replace keeps member order",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			desc:  "replace whole document",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "replace", "path": "", "value": null}]`,
+			want:  `null`,
+		},
+		{
+			desc:  "move member",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			desc:  "move element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			desc:  "move to itself",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo"}]`,
+			want:  `{"foo":1}`,
+		},
+		{
+			desc:  "copy",
+			doc:   `{"foo": {"a": [1]}}`,
+			patch: `[{"op": "copy", "from": "/foo", "path": "/bar"}, {"op": "add", "path": "/bar/a/-", "value": 2}]`,
+			want:  `{"foo":{"a":[1]},"bar":{"a":[1,2]}}`,
+		},
+		{
+			desc:  "test",
+			doc:   `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2.0}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			desc:  "test compares objects regardless of order",
+			doc:   `{"a": {"x": 1, "y": [true]}}`,
+			patch: `[{"op": "test", "path": "/a", "value": {"y": [true], "x": 1}}]`,
+			want:  `{"a":{"x":1,"y":[true]}}`,
+		},
+		{
+			desc:  "escaped pointers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": 10}, {"op": "remove", "path": "/~1"}]`,
+			want:  `{"~1":10}`,
+		},
+		{
+			desc:  "ignores unknown members",
+			doc:   `{}`,
+			patch: `[{"op": "add", "path": "/a", "value": 1, "comment": "why not"}]`,
+			want:  `{"a":1}`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			patch, err := jp.ParsePatch(parse(t, tC.patch))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			doc := parse(t, tC.doc)
+			before := jp.FormatString(doc, jp.FormatOptions{})
+
+			got, err := patch.Apply(doc)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if s := jp.FormatString(got, jp.FormatOptions{}); s != tC.want {
+				t.Fatalf("Bad result: got %s, want %s", s, tC.want)
+			}
+			if after := jp.FormatString(doc, jp.FormatOptions{}); after != before {
+				t.Fatalf("Original modified: got %s, want %s", after, before)
+			}
+		})
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		patch string
+		index int
+		cause error
+	}{
+		{
+			desc:  "missing member",
+			patch: `[{"op": "remove", "path": "/a"}, {"op": "remove", "path": "/missing"}]`,
+			index: 1,
+			cause: jp.ErrPointerNotFound,
+		},
+		{
+			desc:  "replace missing member",
+			patch: `[{"op": "replace", "path": "/nope", "value": 1}]`,
+			index: 0,
+			cause: jp.ErrPointerNotFound,
+		},
+		{
+			desc:  "add past end of array",
+			patch: `[{"op": "add", "path": "/b/3", "value": 1}]`,
+			index: 0,
+			cause: jp.ErrPointerNotFound,
+		},
+		{
+			desc:  "add beneath missing parent",
+			patch: `[{"op": "add", "path": "/x/y", "value": 1}]`,
+			index: 0,
+			cause: jp.ErrPointerNotFound,
+		},
+		{
+			desc:  "add to scalar",
+			patch: `[{"op": "add", "path": "/a/x", "value": 1}]`,
+			index: 0,
+			cause: jp.ErrPointerNotFound,
+		},
+		{
+			desc:  "failed test",
+			patch: `[{"op": "add", "path": "/c", "value": 1}, {"op": "test", "path": "/a", "value": "1"}]`,
+			index: 1,
+			cause: jp.ErrTestFailed,
+		},
+		{
+			desc:  "move into child",
+			patch: `[{"op": "move", "from": "/b", "path": "/b/0"}]`,
+			index: 0,
+		},
+		{
+			desc:  "remove document",
+			patch: `[{"op": "remove", "path": ""}]`,
+			index: 0,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			patch, err := jp.ParsePatch(parse(t, tC.patch))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			doc := parse(t, `{"a": 1, "b": [1, 2]}`)
+
+			_, err = patch.Apply(doc)
+			var pe *jp.PatchError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Bad error: got %v, want a *PatchError", err)
+			}
+			if pe.Index != tC.index {
+				t.Fatalf("Bad index: got %d, want %d (%v)", pe.Index, tC.index, err)
+			}
+			if tC.cause != nil && !errors.Is(err, tC.cause) {
+				t.Fatalf("Bad cause: got %v, want %v", err, tC.cause)
+			}
+			if got := jp.FormatString(doc, jp.FormatOptions{}); got != `{"a":1,"b":[1,2]}` {
+				t.Fatalf("Original modified: got %s", got)
+			}
+		})
+	}
+}
+
+func TestParsePatchErrors(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		patch string
+	}{
+		{desc: "not an array", patch: `{"op": "add"}`},
+		{desc: "not an object", patch: `[1]`},
+		{desc: "missing op", patch: `[{"path": "/a"}]`},
+		{desc: "unknown op", patch: `[{"op": "frob", "path": "/a"}]`},
+		{desc: "missing path", patch: `[{"op": "remove"}]`},
+		{desc: "path not a string", patch: `[{"op": "remove", "path": 1}]`},
+		{desc: "bad path", patch: `[{"op": "remove", "path": "a"}]`},
+		{desc: "missing value", patch: `[{"op": "add", "path": "/a"}]`},
+		{desc: "missing from", patch: `[{"op": "copy", "path": "/a"}]`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := jp.ParsePatch(parse(t, tC.patch))
+			if !errors.Is(err, jp.ErrInvalidPatch) {
+				t.Fatalf("Bad error: got %v, want %v", err, jp.ErrInvalidPatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPointer  = errors.New("invalid JSON pointer")
+	ErrPointerNotFound = errors.New("JSON pointer did not resolve")
+)
+
+// Pointer is an RFC 6901 JSON Pointer held as its unescaped reference
+// tokens. The empty pointer refers to the whole document.
+type Pointer []string
+
+func ParsePointer(s string) (Pointer, error) {
+	if s == "" {
+		return Pointer{}, nil
+	}
+	if s[0] != '/' {
+		return nil, fmt.Errorf("%w %q: must be empty or start with '/'", ErrInvalidPointer, s)
+	}
+
+	tokens := strings.Split(s[1:], "/")
+	for i, tok := range tokens {
+		for j := 0; j < len(tok); j++ {
+			if tok[j] == '~' && (j+1 == len(tok) || (tok[j+1] != '0' && tok[j+1] != '1')) {
+				return nil, fmt.Errorf(
+					"%w %q: '~' must be followed by '0' or '1' in reference token %d",
+					ErrInvalidPointer,
+					s,
+					i,
+				)
+			}
+		}
+		tokens[i] = pointerUnescaper.Replace(tok)
+	}
+
+	return Pointer(tokens), nil
+}
+
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+func (p Pointer) String() string {
+	var buf strings.Builder
+	for _, tok := range p {
+		buf.WriteByte('/')
+		buf.WriteString(pointerEscaper.Replace(tok))
+	}
+	return buf.String()
+}
+
+// PointerError says which reference token of a pointer couldn't be followed
+// and why.
+type PointerError struct {
+	Pointer Pointer
+	Index   int
+	Reason  string
+}
+
+func (e *PointerError) Error() string {
+	return fmt.Sprintf(
+		"pointer %q: reference token %d (%q) did not resolve: %s",
+		e.Pointer.String(),
+		e.Index,
+		e.Pointer[e.Index],
+		e.Reason,
+	)
+}
+
+func (e *PointerError) Unwrap() error {
+	return ErrPointerNotFound
+}
+
+// Resolve finds the value p refers to within doc.
+func (p Pointer) Resolve(doc Value) (Value, error) {
+	return p.resolve(doc, len(p))
+}
+
+// resolve follows the first n reference tokens of p from doc.
+func (p Pointer) resolve(doc Value, n int) (Value, error) {
+	v := doc
+	for i := range n {
+		next, err := p.step(v, i)
+		if err != nil {
+			return nil, err
+		}
+		v = next
+	}
+	return v, nil
+}
+
+// step follows the ith reference token from v.
+func (p Pointer) step(v Value, i int) (Value, error) {
+	tok := p[i]
+	switch v := v.(type) {
+	case *Object:
+		if m, ok := v.Get(tok); ok {
+			return m, nil
+		}
+		return nil, &PointerError{p, i, fmt.Sprintf("object has no member %q", tok)}
+	case *Array:
+		idx, err := p.index(v, i, false)
+		if err != nil {
+			return nil, err
+		}
+		return v.Elems[idx], nil
+	}
+
+	return nil, &PointerError{p, i, fmt.Sprintf("cannot look up a member of a %s", v.Kind())}
+}
+
+// index converts the ith reference token to an index into arr. The index
+// just past the end, which "-" always refers to, is only allowed when
+// appending is.
+func (p Pointer) index(arr *Array, i int, appending bool) (int, error) {
+	tok := p[i]
+	if tok == "-" {
+		if appending {
+			return len(arr.Elems), nil
+		}
+		return 0, &PointerError{p, i, `"-" refers to the nonexistent element after the last`}
+	}
+
+	idx, err := strconv.Atoi(tok)
+	if err != nil || !isArrayIndex(tok) {
+		return 0, &PointerError{p, i, fmt.Sprintf("%q is not an array index", tok)}
+	}
+
+	size := len(arr.Elems)
+	if appending {
+		size++
+	}
+	if idx >= size {
+		return 0, &PointerError{
+			p,
+			i,
+			fmt.Sprintf("index %d is out of range for an array of %d elements", idx, len(arr.Elems)),
+		}
+	}
+
+	return idx, nil
+}
+
+// isArrayIndex reports whether tok is spelt the way RFC 6901 requires of an
+// index: only digits and no leading zeros.
+func isArrayIndex(tok string) bool {
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') {
+		return false
+	}
+	for i := 0; i < len(tok); i++ {
+		if tok[i] < '0' || tok[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
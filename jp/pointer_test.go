@@ -0,0 +1,147 @@
+package main_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+const rfc6901Doc = `{
+	"foo": ["bar", "baz"],
+	"": 0,
+	"a/b": 1,
+	"c%d": 2,
+	"e^f": 3,
+	"g|h": 4,
+	"i\\j": 5,
+	"k\"l": 6,
+	" ": 7,
+	"m~n": 8,
+	"~01": 9
+}`
+
+func TestPointerResolve(t *testing.T) {
+	testCases := []struct {
+		ptr  string
+		want string
+	}{
+		{ptr: "", want: `{"foo":["bar","baz"],"":0,"a/b":1,"c%d":2,"e^f":3,"g|h":4,"i\\j":5,"k\"l":6," ":7,"m~n":8,"~01":9}`},
+		{ptr: "/foo", want: `["bar","baz"]`},
+		{ptr: "/foo/0", want: `"bar"`},
+		{ptr: "/foo/1", want: `"baz"`},
+		{ptr: "/", want: "0"},
+		{ptr: "/a~1b", want: "1"},
+		{ptr: "/c%d", want: "2"},
+		{ptr: "/e^f", want: "3"},
+		{ptr: "/g|h", want: "4"},
+		{ptr: `/i\j`, want: "5"},
+		{ptr: `/k"l`, want: "6"},
+		{ptr: "/ ", want: "7"},
+		{ptr: "/m~0n", want: "8"},
+		{ptr: "/~001", want: "9"},
+	}
+	doc := parse(t, rfc6901Doc)
+	for _, tC := range testCases {
+		t.Run(tC.ptr, func(t *testing.T) {
+			ptr, err := jp.ParsePointer(tC.ptr)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ptr.String() != tC.ptr {
+				t.Fatalf("Pointer doesn't round trip, got %q, want %q", ptr, tC.ptr)
+			}
+			v, err := ptr.Resolve(doc)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := jp.FormatString(v, jp.FormatOptions{}); got != tC.want {
+				t.Fatalf("Wrong value, got %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestPointerNotFound(t *testing.T) {
+	testCases := []struct {
+		ptr   string
+		index int
+		err   string
+	}{
+		{ptr: "/bar", index: 0, err: `object has no member "bar"`},
+		{ptr: "/foo/2", index: 1, err: "index 2 is out of range for an array of 2 elements"},
+		{ptr: "/foo/-", index: 1, err: `"-" refers to the nonexistent element after the last`},
+		{ptr: "/foo/01", index: 1, err: `"01" is not an array index`},
+		{ptr: "/foo/-0", index: 1, err: `"-0" is not an array index`},
+		{ptr: "/foo/+1", index: 1, err: `"+1" is not an array index`},
+		{ptr: "/foo/x", index: 1, err: `"x" is not an array index`},
+		{ptr: "/foo/0/x", index: 2, err: "cannot look up a member of a string"},
+		{ptr: "/a~1b/c", index: 1, err: "cannot look up a member of a number"},
+	}
+	doc := parse(t, rfc6901Doc)
+	for _, tC := range testCases {
+		t.Run(tC.ptr, func(t *testing.T) {
+			ptr, err := jp.ParsePointer(tC.ptr)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			_, err = ptr.Resolve(doc)
+			var perr *jp.PointerError
+			if !errors.As(err, &perr) || !errors.Is(err, jp.ErrPointerNotFound) {
+				t.Fatalf("Wrong error, got %v", err)
+			}
+			if perr.Index != tC.index {
+				t.Fatalf("Wrong reference token, got %d, want %d", perr.Index, tC.index)
+			}
+			if !strings.HasSuffix(err.Error(), tC.err) {
+				t.Fatalf("Wrong error, got %q, want %q", err, tC.err)
+			}
+		})
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	testCases := []struct {
+		ptr  string
+		want jp.Pointer
+		err  bool
+	}{
+		{ptr: "", want: jp.Pointer{}},
+		{ptr: "/", want: jp.Pointer{""}},
+		{ptr: "//", want: jp.Pointer{"", ""}},
+		{ptr: "/a~1b~0c/0", want: jp.Pointer{"a/b~c", "0"}},
+		{ptr: "/~01", want: jp.Pointer{"~1"}},
+		{ptr: "a", err: true},
+		{ptr: "/~2", err: true},
+		{ptr: "/a~", err: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.ptr, func(t *testing.T) {
+			got, err := jp.ParsePointer(tC.ptr)
+			if tC.err {
+				if !errors.Is(err, jp.ErrInvalidPointer) {
+					t.Fatalf("Wrong error, got %v, want %v", err, jp.ErrInvalidPointer)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("Bad pointer, got %q, want %q", got, tC.want)
+			}
+		})
+	}
+}
+
+func parse(t *testing.T, data string) jp.Value {
+	t.Helper()
+	p := jp.NewParser(strings.NewReader(data))
+	v, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	return v
+}
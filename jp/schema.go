@@ -0,0 +1,564 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidSchema   = errors.New("invalid schema")
+	ErrSchemaViolation = errors.New("document does not match schema")
+)
+
+// Schema is a compiled JSON Schema, draft 2020-12. It understands the
+// assertion and applicator keywords for types, objects, arrays, strings,
+// numbers and combining schemas; anything else is ignored as an annotation.
+// References must be local to the schema.
+type Schema struct {
+	root     Value
+	refs     map[string]Value
+	anchors  map[string]Pointer
+	patterns map[string]*regexp.Regexp
+}
+
+// CompileSchema checks that doc is a usable schema and prepares it for
+// validating documents.
+func CompileSchema(doc Value) (*Schema, error) {
+	s := &Schema{
+		root:     doc,
+		refs:     map[string]Value{},
+		anchors:  map[string]Pointer{},
+		patterns: map[string]*regexp.Regexp{},
+	}
+
+	var refs []schemaRef
+	if err := s.compile(Pointer{}, doc, &refs); err != nil {
+		return nil, err
+	}
+	// A reference can point anywhere in the document, including places the
+	// keywords above don't lead to, so each target is compiled in turn, which
+	// may turn up more references.
+	for i := 0; i < len(refs); i++ {
+		ref := refs[i]
+		if _, ok := s.refs[ref.ref]; ok {
+			continue
+		}
+		target, loc, err := s.resolve(ref.ref)
+		if err != nil {
+			return nil, schemaError(ref.loc, "%s", err)
+		}
+		s.refs[ref.ref] = target
+		if err := s.compile(loc, target, &refs); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// schemaRef is a $ref waiting to be resolved once every $anchor is known.
+type schemaRef struct {
+	loc Pointer
+	ref string
+}
+
+func schemaError(loc Pointer, format string, args ...any) error {
+	return fmt.Errorf("%w at %s: %s", ErrInvalidSchema, describePath(loc), fmt.Sprintf(format, args...))
+}
+
+var schemaTypes = []string{"null", "boolean", "object", "array", "number", "string", "integer"}
+
+func (s *Schema) compile(loc Pointer, v Value, refs *[]schemaRef) error {
+	switch v.(type) {
+	case *Bool:
+		return nil
+	case *Object:
+	default:
+		return schemaError(loc, "a schema must be an object or a boolean, got %s", v.Kind())
+	}
+
+	for _, m := range v.(*Object).Members {
+		kw := append(slices.Clip(loc), m.Key)
+		var err error
+		switch m.Key {
+		case "type":
+			err = compileType(kw, m.Value)
+		case "properties", "patternProperties", "$defs":
+			err = s.compileSchemaMap(kw, m.Value, m.Key == "patternProperties", refs)
+		case "additionalProperties", "items", "not":
+			err = s.compile(kw, m.Value, refs)
+		case "prefixItems", "allOf", "anyOf", "oneOf":
+			err = s.compileSchemaList(kw, m.Value, refs)
+		case "required":
+			err = compileStrings(kw, m.Value)
+		case "enum":
+			if _, ok := m.Value.(*Array); !ok {
+				err = schemaError(kw, "must be an array")
+			}
+		case "pattern":
+			err = s.compilePattern(kw, m.Value)
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			if _, ok := m.Value.(*Number); !ok {
+				err = schemaError(kw, "must be a number")
+			}
+		case "minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties":
+			if _, ok := count(m.Value); !ok {
+				err = schemaError(kw, "must be a non-negative integer")
+			}
+		case "$ref":
+			str, ok := m.Value.(*String)
+			if !ok {
+				err = schemaError(kw, "must be a string")
+				break
+			}
+			*refs = append(*refs, schemaRef{loc: kw, ref: str.Value})
+		case "$anchor":
+			str, ok := m.Value.(*String)
+			if !ok {
+				err = schemaError(kw, "must be a string")
+				break
+			}
+			s.anchors[str.Value] = slices.Clone(loc)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileType(loc Pointer, v Value) error {
+	names := []Value{v}
+	if arr, ok := v.(*Array); ok {
+		names = arr.Elems
+	}
+	for _, name := range names {
+		str, ok := name.(*String)
+		if !ok || !slices.Contains(schemaTypes, str.Value) {
+			return schemaError(loc, "must name one or more of %s", strings.Join(schemaTypes, ", "))
+		}
+	}
+	return nil
+}
+
+func compileStrings(loc Pointer, v Value) error {
+	arr, ok := v.(*Array)
+	if !ok {
+		return schemaError(loc, "must be an array of strings")
+	}
+	for _, e := range arr.Elems {
+		if _, ok := e.(*String); !ok {
+			return schemaError(loc, "must be an array of strings")
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compileSchemaMap(loc Pointer, v Value, patterns bool, refs *[]schemaRef) error {
+	obj, ok := v.(*Object)
+	if !ok {
+		return schemaError(loc, "must be an object")
+	}
+	for _, m := range obj.Members {
+		sub := append(slices.Clip(loc), m.Key)
+		if patterns {
+			if err := s.compilePattern(sub, &String{Value: m.Key}); err != nil {
+				return err
+			}
+		}
+		if err := s.compile(sub, m.Value, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compileSchemaList(loc Pointer, v Value, refs *[]schemaRef) error {
+	arr, ok := v.(*Array)
+	if !ok || len(arr.Elems) == 0 {
+		return schemaError(loc, "must be a non-empty array of schemas")
+	}
+	for i, e := range arr.Elems {
+		if err := s.compile(append(slices.Clip(loc), fmt.Sprint(i)), e, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compilePattern(loc Pointer, v Value) error {
+	str, ok := v.(*String)
+	if !ok {
+		return schemaError(loc, "must be a string")
+	}
+	re, err := regexp.Compile(str.Value)
+	if err != nil {
+		return schemaError(loc, "bad pattern: %s", err)
+	}
+	s.patterns[str.Value] = re
+	return nil
+}
+
+// resolve finds the schema a local reference points at, either by a JSON
+// Pointer fragment or by an $anchor, along with where it is.
+func (s *Schema) resolve(ref string) (Value, Pointer, error) {
+	frag, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, nil, fmt.Errorf("only local references are supported, got %q", ref)
+	}
+	frag, err := url.PathUnescape(frag)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad reference %q: %w", ref, err)
+	}
+
+	var ptr Pointer
+	if frag != "" && frag[0] != '/' {
+		if ptr, ok = s.anchors[frag]; !ok {
+			return nil, nil, fmt.Errorf("no $anchor named %q", frag)
+		}
+	} else if ptr, err = ParsePointer(frag); err != nil {
+		return nil, nil, err
+	}
+	target, err := ptr.Resolve(s.root)
+	return target, ptr, err
+}
+
+// count reads a keyword value that has to be a non-negative integer.
+func count(v Value) (int, bool) {
+	n, ok := v.(*Number)
+	if !ok {
+		return 0, false
+	}
+	r, ok := new(big.Rat).SetString(n.Literal)
+	if !ok || !r.IsInt() || r.Sign() < 0 || !r.Num().IsInt64() {
+		return 0, false
+	}
+	return int(r.Num().Int64()), true
+}
+
+// ValidationError is a single way in which a document breaks its schema.
+// InstanceLocation points at the offending value, KeywordLocation at the
+// keyword it failed, following any $refs on the way. Pos is where the value
+// starts in the input, if that is known.
+type ValidationError struct {
+	InstanceLocation Pointer
+	KeywordLocation  Pointer
+	Pos              Position
+	Msg              string
+}
+
+func (e *ValidationError) Error() string {
+	var buf strings.Builder
+	if e.Pos.Line > 0 {
+		fmt.Fprintf(&buf, "%s: ", e.Pos)
+	}
+	fmt.Fprintf(
+		&buf,
+		"%s: %s (keyword %s)",
+		describePath(e.InstanceLocation),
+		e.Msg,
+		describePath(e.KeywordLocation),
+	)
+	return buf.String()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrSchemaViolation
+}
+
+// ValidationErrors holds every problem found with a document.
+type ValidationErrors []*ValidationError
+
+func (l ValidationErrors) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+func (l ValidationErrors) Unwrap() []error {
+	errs := make([]error, 0, len(l))
+	for _, err := range l {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Validate checks doc against the schema, returning ValidationErrors listing
+// everything wrong with it. Positions, which may be nil, lets the errors say
+// where in the input each problem is.
+func (s *Schema) Validate(doc Value, pos Positions) error {
+	v := validator{schema: s, pos: pos, active: map[visit]bool{}}
+	if errs := v.validate(s.root, doc, Pointer{}, Pointer{}); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// visit is a schema being applied to a value. Seeing the same one again
+// while it is still being checked means the schema's references go round in
+// a loop without getting any further into the document.
+type visit struct {
+	schema, inst Value
+}
+
+type validator struct {
+	schema *Schema
+	pos    Positions
+	active map[visit]bool
+}
+
+func (v *validator) fail(inst Value, ip, kp Pointer, format string, args ...any) *ValidationError {
+	return &ValidationError{
+		InstanceLocation: slices.Clone(ip),
+		KeywordLocation:  slices.Clone(kp),
+		Pos:              v.pos[inst],
+		Msg:              fmt.Sprintf(format, args...),
+	}
+}
+
+func (v *validator) validate(schema, inst Value, ip, kp Pointer) ValidationErrors {
+	s, ok := schema.(*Object)
+	if !ok {
+		if b, ok := schema.(*Bool); ok && !b.Value {
+			return ValidationErrors{v.fail(inst, ip, kp, "no value is allowed here")}
+		}
+		return nil
+	}
+
+	key := visit{schema, inst}
+	if v.active[key] {
+		return ValidationErrors{v.fail(inst, ip, kp, "schema refers back to itself without making progress")}
+	}
+	v.active[key] = true
+	defer delete(v.active, key)
+
+	var errs ValidationErrors
+	for _, m := range s.Members {
+		kw := append(slices.Clip(kp), m.Key)
+		switch m.Key {
+		case "$ref":
+			if ref, ok := m.Value.(*String); ok {
+				errs = append(errs, v.validate(v.schema.refs[ref.Value], inst, ip, kw)...)
+			}
+		case "type":
+			errs = v.checkType(errs, m.Value, inst, ip, kw)
+		case "enum":
+			values, ok := m.Value.(*Array)
+			if ok && !slices.ContainsFunc(values.Elems, func(e Value) bool { return Equal(e, inst) }) {
+				errs = append(errs, v.fail(inst, ip, kw, "must be one of %s", listValues(values.Elems)))
+			}
+		case "const":
+			if !Equal(m.Value, inst) {
+				errs = append(errs, v.fail(inst, ip, kw, "must be %s", compact(m.Value)))
+			}
+		case "allOf":
+			for i, sub := range m.Value.(*Array).Elems {
+				errs = append(errs, v.validate(sub, inst, ip, append(kw, fmt.Sprint(i)))...)
+			}
+		case "anyOf":
+			if v.matches(m.Value, inst, ip, kw) == 0 {
+				errs = append(errs, v.fail(inst, ip, kw, "must match at least one of the schemas"))
+			}
+		case "oneOf":
+			if n := v.matches(m.Value, inst, ip, kw); n != 1 {
+				errs = append(errs, v.fail(inst, ip, kw, "must match exactly one of the schemas, matched %d", n))
+			}
+		case "not":
+			if len(v.validate(m.Value, inst, ip, kw)) == 0 {
+				errs = append(errs, v.fail(inst, ip, kw, "must not match the schema"))
+			}
+		}
+	}
+
+	switch inst := inst.(type) {
+	case *String:
+		errs = v.checkString(errs, s, inst, ip, kp)
+	case *Number:
+		errs = v.checkNumber(errs, s, inst, ip, kp)
+	case *Array:
+		errs = v.checkArray(errs, s, inst, ip, kp)
+	case *Object:
+		errs = v.checkObject(errs, s, inst, ip, kp)
+	}
+
+	return errs
+}
+
+// matches counts how many of the schemas inst is valid against.
+func (v *validator) matches(schemas, inst Value, ip, kp Pointer) int {
+	n := 0
+	for i, sub := range schemas.(*Array).Elems {
+		if len(v.validate(sub, inst, ip, append(kp, fmt.Sprint(i)))) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (v *validator) checkType(errs ValidationErrors, want, inst Value, ip, kp Pointer) ValidationErrors {
+	names := []Value{want}
+	if arr, ok := want.(*Array); ok {
+		names = arr.Elems
+	}
+
+	var allowed []string
+	for _, name := range names {
+		t := name.(*String).Value
+		if t == string(inst.Kind()) || (t == "integer" && isInteger(inst)) || (t == "number" && inst.Kind() == NumberKind) {
+			return errs
+		}
+		allowed = append(allowed, t)
+	}
+
+	return append(errs, v.fail(inst, ip, kp, "must be %s, got %s", strings.Join(allowed, " or "), inst.Kind()))
+}
+
+func isInteger(v Value) bool {
+	n, ok := v.(*Number)
+	if !ok {
+		return false
+	}
+	r, ok := new(big.Rat).SetString(n.Literal)
+	return ok && r.IsInt()
+}
+
+func (v *validator) checkString(errs ValidationErrors, s *Object, inst *String, ip, kp Pointer) ValidationErrors {
+	length := utf8.RuneCountInString(inst.Value)
+	if n, ok := keywordCount(s, "minLength"); ok && length < n {
+		errs = append(errs, v.fail(inst, ip, append(kp, "minLength"), "must be at least %d characters long", n))
+	}
+	if n, ok := keywordCount(s, "maxLength"); ok && length > n {
+		errs = append(errs, v.fail(inst, ip, append(kp, "maxLength"), "must be at most %d characters long", n))
+	}
+	if p, ok := s.Get("pattern"); ok {
+		pattern := p.(*String).Value
+		if !v.schema.patterns[pattern].MatchString(inst.Value) {
+			errs = append(errs, v.fail(inst, ip, append(kp, "pattern"), "must match the pattern %q", pattern))
+		}
+	}
+	return errs
+}
+
+func (v *validator) checkNumber(errs ValidationErrors, s *Object, inst *Number, ip, kp Pointer) ValidationErrors {
+	limits := []struct {
+		keyword string
+		fails   func(cmp int) bool
+		msg     string
+	}{
+		{"minimum", func(c int) bool { return c < 0 }, "must be at least %s"},
+		{"maximum", func(c int) bool { return c > 0 }, "must be at most %s"},
+		{"exclusiveMinimum", func(c int) bool { return c <= 0 }, "must be greater than %s"},
+		{"exclusiveMaximum", func(c int) bool { return c >= 0 }, "must be less than %s"},
+	}
+	for _, lim := range limits {
+		bound, ok := s.Get(lim.keyword)
+		if !ok {
+			continue
+		}
+		bn := bound.(*Number)
+		if lim.fails(compareNumbers(inst, bn)) {
+			errs = append(errs, v.fail(inst, ip, append(kp, lim.keyword), lim.msg, bn.Literal))
+		}
+	}
+	return errs
+}
+
+func (v *validator) checkArray(errs ValidationErrors, s *Object, inst *Array, ip, kp Pointer) ValidationErrors {
+	if n, ok := keywordCount(s, "minItems"); ok && len(inst.Elems) < n {
+		errs = append(errs, v.fail(inst, ip, append(kp, "minItems"), "must have at least %d items", n))
+	}
+	if n, ok := keywordCount(s, "maxItems"); ok && len(inst.Elems) > n {
+		errs = append(errs, v.fail(inst, ip, append(kp, "maxItems"), "must have at most %d items", n))
+	}
+
+	prefix := 0
+	if p, ok := s.Get("prefixItems"); ok {
+		schemas := p.(*Array).Elems
+		for i, e := range inst.Elems[:min(len(schemas), len(inst.Elems))] {
+			kw := append(slices.Clip(kp), "prefixItems", fmt.Sprint(i))
+			errs = append(errs, v.validate(schemas[i], e, append(ip, fmt.Sprint(i)), kw)...)
+		}
+		prefix = len(schemas)
+	}
+	if items, ok := s.Get("items"); ok {
+		for i := prefix; i < len(inst.Elems); i++ {
+			errs = append(errs, v.validate(items, inst.Elems[i], append(ip, fmt.Sprint(i)), append(kp, "items"))...)
+		}
+	}
+	return errs
+}
+
+func (v *validator) checkObject(errs ValidationErrors, s *Object, inst *Object, ip, kp Pointer) ValidationErrors {
+	keys := uniqueKeys(inst)
+	if n, ok := keywordCount(s, "minProperties"); ok && len(keys) < n {
+		errs = append(errs, v.fail(inst, ip, append(kp, "minProperties"), "must have at least %d properties", n))
+	}
+	if n, ok := keywordCount(s, "maxProperties"); ok && len(keys) > n {
+		errs = append(errs, v.fail(inst, ip, append(kp, "maxProperties"), "must have at most %d properties", n))
+	}
+	if req, ok := s.Get("required"); ok {
+		for _, name := range req.(*Array).Elems {
+			if _, ok := inst.Get(name.(*String).Value); !ok {
+				errs = append(errs, v.fail(inst, ip, append(kp, "required"), "missing required property %q", name.(*String).Value))
+			}
+		}
+	}
+
+	props, _ := s.Get("properties")
+	patterns, _ := s.Get("patternProperties")
+	additional, hasAdditional := s.Get("additionalProperties")
+	for _, k := range keys {
+		val, _ := inst.Get(k)
+		child := append(ip, k)
+		matched := false
+		if props, ok := props.(*Object); ok {
+			if sub, ok := props.Get(k); ok {
+				matched = true
+				errs = append(errs, v.validate(sub, val, child, append(slices.Clip(kp), "properties", k))...)
+			}
+		}
+		if patterns, ok := patterns.(*Object); ok {
+			for _, p := range patterns.Members {
+				if v.schema.patterns[p.Key].MatchString(k) {
+					matched = true
+					kw := append(slices.Clip(kp), "patternProperties", p.Key)
+					errs = append(errs, v.validate(p.Value, val, child, kw)...)
+				}
+			}
+		}
+		if !matched && hasAdditional {
+			if b, ok := additional.(*Bool); ok && !b.Value {
+				errs = append(errs, v.fail(val, child, append(kp, "additionalProperties"), "property %q is not allowed", k))
+				continue
+			}
+			errs = append(errs, v.validate(additional, val, child, append(kp, "additionalProperties"))...)
+		}
+	}
+	return errs
+}
+
+func keywordCount(s *Object, keyword string) (int, bool) {
+	v, ok := s.Get(keyword)
+	if !ok {
+		return 0, false
+	}
+	return count(v)
+}
+
+func listValues(vs []Value) string {
+	names := make([]string, 0, len(vs))
+	for _, v := range vs {
+		names = append(names, compact(v))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,222 @@
+package main_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+const configSchema = `{
+	"$defs": {
+		"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+		"host": {"$anchor": "host", "type": "string", "minLength": 1, "pattern": "^[a-z0-9.-]+$"}
+	},
+	"type": "object",
+	"required": ["name", "server"],
+	"properties": {
+		"name": {"type": "string", "maxLength": 8},
+		"server": {
+			"type": "object",
+			"properties": {
+				"host": {"$ref": "#host"},
+				"port": {"$ref": "#/$defs/port"}
+			},
+			"additionalProperties": false
+		},
+		"mode": {"enum": ["dev", "prod"]},
+		"version": {"const": 2},
+		"ratio": {"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 1},
+		"tags": {"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 3},
+		"pair": {"prefixItems": [{"type": "string"}, {"type": "number"}], "items": false},
+		"limits": {"type": "object", "patternProperties": {"^max_": {"type": "integer"}}, "minProperties": 1},
+		"owner": {"anyOf": [{"type": "string"}, {"type": "null"}]},
+		"size": {"oneOf": [{"type": "integer"}, {"minimum": 10}]},
+		"id": {"allOf": [{"type": "string"}, {"not": {"const": ""}}]},
+		"extra": true,
+		"never": false
+	}
+}`
+
+func TestSchemaValid(t *testing.T) {
+	testCases := []string{
+		`{"name": "a", "server": {"host": "db.local", "port": 5432}}`,
+		`{"name": "a", "server": {}, "mode": "prod", "version": 2.0, "ratio": 0.5}`,
+		`{"name": "a", "server": {}, "tags": ["x"], "pair": ["a", 1], "limits": {"max_conns": 10, "other": "x"}}`,
+		`{"name": "a", "server": {}, "owner": null, "size": 10.5, "id": "x", "extra": [1, {"a": null}]}`,
+	}
+	schema := compileSchema(t, configSchema)
+	for _, tC := range testCases {
+		t.Run(tC, func(t *testing.T) {
+			if err := schema.Validate(parse(t, tC), nil); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSchemaInvalid(t *testing.T) {
+	testCases := []struct {
+		doc  string
+		want []string
+	}{
+		{
+			doc:  `[]`,
+			want: []string{`(root): must be object, got array (keyword /type)`},
+		},
+		{
+			doc: `{"server": {"port": 0, "host": "", "user": "x"}}`,
+			want: []string{
+				`(root): missing required property "name" (keyword /required)`,
+				`/server/port: must be at least 1 (keyword /properties/server/properties/port/$ref/minimum)`,
+				`/server/host: must be at least 1 characters long (keyword /properties/server/properties/host/$ref/minLength)`,
+				`/server/host: must match the pattern "^[a-z0-9.-]+$" (keyword /properties/server/properties/host/$ref/pattern)`,
+				`/server/user: property "user" is not allowed (keyword /properties/server/additionalProperties)`,
+			},
+		},
+		{
+			doc: `{"name": "much too long", "server": {"port": 80.5}, "mode": "test", "version": 3}`,
+			want: []string{
+				`/name: must be at most 8 characters long (keyword /properties/name/maxLength)`,
+				`/server/port: must be integer, got number (keyword /properties/server/properties/port/$ref/type)`,
+				`/mode: must be one of "dev", "prod" (keyword /properties/mode/enum)`,
+				`/version: must be 2 (keyword /properties/version/const)`,
+			},
+		},
+		{
+			doc: `{"name": "a", "server": {}, "ratio": 1, "tags": [], "pair": ["a", "b", "c"], "limits": {}}`,
+			want: []string{
+				`/ratio: must be less than 1 (keyword /properties/ratio/exclusiveMaximum)`,
+				`/tags: must have at least 1 items (keyword /properties/tags/minItems)`,
+				`/pair/1: must be number, got string (keyword /properties/pair/prefixItems/1/type)`,
+				`/pair/2: no value is allowed here (keyword /properties/pair/items)`,
+				`/limits: must have at least 1 properties (keyword /properties/limits/minProperties)`,
+			},
+		},
+		{
+			doc: `{"name": "a", "server": {}, "tags": [1, "a", "b", "c"], "limits": {"max_x": "y"}}`,
+			want: []string{
+				`/tags: must have at most 3 items (keyword /properties/tags/maxItems)`,
+				`/tags/0: must be string, got number (keyword /properties/tags/items/type)`,
+				`/limits/max_x: must be integer, got string (keyword /properties/limits/patternProperties/^max_/type)`,
+			},
+		},
+		{
+			doc: `{"name": "a", "server": {}, "owner": 1, "size": 12, "id": "", "never": 1}`,
+			want: []string{
+				`/owner: must match at least one of the schemas (keyword /properties/owner/anyOf)`,
+				`/size: must match exactly one of the schemas, matched 2 (keyword /properties/size/oneOf)`,
+				`/id: must not match the schema (keyword /properties/id/allOf/1/not)`,
+				`/never: no value is allowed here (keyword /properties/never)`,
+			},
+		},
+	}
+	schema := compileSchema(t, configSchema)
+	for _, tC := range testCases {
+		t.Run(tC.doc, func(t *testing.T) {
+			err := schema.Validate(parse(t, tC.doc), nil)
+			if !errors.Is(err, jp.ErrSchemaViolation) {
+				t.Fatalf("Bad error: got %v, want %v", err, jp.ErrSchemaViolation)
+			}
+			var errs jp.ValidationErrors
+			errors.As(err, &errs)
+			got := make([]string, 0, len(errs))
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tC.want, "\n") {
+				t.Fatalf("Bad errors: got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tC.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestSchemaErrorPositions(t *testing.T) {
+	schema := compileSchema(t, `{"items": {"properties": {"port": {"maximum": 100}}}}`)
+	p := jp.NewParserWithOptions(strings.NewReader("[\n  {\"port\": 80},\n  {\"port\": 8080}\n]"), jp.Options{TrackPositions: true})
+	doc, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = schema.Validate(doc, p.Positions())
+	want := "line 3, column 12: /1/port: must be at most 100 (keyword /items/properties/port/maximum)"
+	if err == nil || err.Error() != want {
+		t.Fatalf("Bad error: got %v, want %s", err, want)
+	}
+}
+
+func TestSchemaRefLoop(t *testing.T) {
+	schema := compileSchema(t, `{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`)
+	if err := schema.Validate(parse(t, `1`), nil); !errors.Is(err, jp.ErrSchemaViolation) {
+		t.Fatalf("Bad error: got %v, want %v", err, jp.ErrSchemaViolation)
+	}
+
+	tree := compileSchema(t, `{"type": "object", "properties": {"child": {"$ref": "#"}}, "required": ["v"]}`)
+	if err := tree.Validate(parse(t, `{"v": 1, "child": {"v": 2, "child": {"v": 3}}}`), nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := tree.Validate(parse(t, `{"v": 1, "child": {"child": {"v": 3}}}`), nil); err == nil {
+		t.Fatalf("Got nil but wanted error")
+	}
+}
+
+func TestSchemaRefOutsideKeywords(t *testing.T) {
+	schema := compileSchema(t, `{
+		"definitions": {
+			"a": {"pattern": "^x", "enum": ["xy", "z"]},
+			"b": {"$ref": "#/definitions/a"}
+		},
+		"$ref": "#/definitions/b"
+	}`)
+	if err := schema.Validate(parse(t, `"xy"`), nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `(root): must match the pattern "^x" (keyword /$ref/$ref/pattern)`
+	if err := schema.Validate(parse(t, `"z"`), nil); err == nil || err.Error() != want {
+		t.Fatalf("Bad error: got %v, want %s", err, want)
+	}
+}
+
+func TestBadSchema(t *testing.T) {
+	testCases := []string{
+		`1`,
+		`{"type": "int"}`,
+		`{"type": ["string", 1]}`,
+		`{"properties": []}`,
+		`{"properties": {"a": 1}}`,
+		`{"allOf": []}`,
+		`{"required": [1]}`,
+		`{"enum": 1}`,
+		`{"pattern": "("}`,
+		`{"patternProperties": {"(": {}}}`,
+		`{"minimum": "1"}`,
+		`{"minLength": -1}`,
+		`{"maxItems": 1.5}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"$ref": "#nowhere"}`,
+		`{"$ref": "other.json#/a"}`,
+		`{"not": {"items": {"$ref": 1}}}`,
+		`{"definitions": {"a": {"pattern": "("}}, "$ref": "#/definitions/a"}`,
+		`{"definitions": {"a": {"enum": 1}}, "$ref": "#/definitions/a"}`,
+		`{"definitions": {"a": {"$ref": 1}}, "$ref": "#/definitions/a"}`,
+		`{"definitions": {"a": {"$ref": "#/definitions/b"}, "b": {"type": "int"}}, "$ref": "#/definitions/a"}`,
+	}
+	for _, tC := range testCases {
+		t.Run(tC, func(t *testing.T) {
+			if _, err := jp.CompileSchema(parse(t, tC)); !errors.Is(err, jp.ErrInvalidSchema) {
+				t.Fatalf("Bad error: got %v, want %v", err, jp.ErrInvalidSchema)
+			}
+		})
+	}
+}
+
+func compileSchema(t *testing.T, data string) *jp.Schema {
+	t.Helper()
+	schema, err := jp.CompileSchema(parse(t, data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return schema
+}
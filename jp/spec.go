@@ -0,0 +1,364 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Spec struct {
+	Format     bool
+	Check      bool
+	Indent     int
+	Tabs       bool
+	SortKeys   bool
+	ArrayWidth int
+	Minify     bool
+	Canonical  bool
+	Digest     bool
+	Lookup     bool
+	Pointer    string
+	Select     bool
+	Query      string
+	Paths      bool
+	Patch      string
+	Write      bool
+	Diff       bool
+	DiffPatch  bool
+	DiffKey    string
+	Numeric    bool
+	NoColor    bool
+	MergePatch string
+	Merge      bool
+	Arrays     string
+	MergeKey   string
+	Blame      bool
+	Schema     string
+	Infer      bool
+	NDJSON     bool
+	MaxEnum    int
+	Relaxed    bool
+	Sequence   bool
+	Duplicates string
+	IJSON      bool
+	FirstError bool
+	MaxDepth   int
+	Sources    []string
+}
+
+func LoadSpec(args []string) (Spec, error) {
+	var spec Spec
+	parser := flag.NewFlagSet("ccjp", flag.ContinueOnError)
+	var usage strings.Builder
+	parser.Usage = func() {
+		parser.SetOutput(&usage)
+		parser.PrintDefaults()
+	}
+	parser.BoolVar(
+		&spec.Format,
+		"fmt",
+		false,
+		"reformat the document",
+	)
+	parser.BoolVar(
+		&spec.Check,
+		"check",
+		false,
+		"exit with an error if the document isn't already formatted",
+	)
+	parser.IntVar(
+		&spec.Indent,
+		"indent",
+		2,
+		"number of spaces to indent each level by when formatting",
+	)
+	parser.BoolVar(
+		&spec.Tabs,
+		"tabs",
+		false,
+		"indent with tabs rather than spaces when formatting",
+	)
+	parser.BoolVar(
+		&spec.SortKeys,
+		"sort",
+		false,
+		"sort object keys when formatting",
+	)
+	parser.IntVar(
+		&spec.ArrayWidth,
+		"array-width",
+		0,
+		"keep arrays of scalars on one line if they fit in this many columns",
+	)
+	parser.BoolVar(
+		&spec.Minify,
+		"minify",
+		false,
+		"strip all insignificant whitespace from the document",
+	)
+	parser.BoolVar(
+		&spec.Canonical,
+		"canon",
+		false,
+		"write the document in RFC 8785 canonical form",
+	)
+	parser.BoolVar(
+		&spec.Digest,
+		"sha256",
+		false,
+		"print the SHA-256 digest of the document's canonical form",
+	)
+	parser.Func(
+		"p",
+		"print the value at this JSON pointer, e.g. /servers/0/host",
+		func(ptr string) error {
+			spec.Lookup = true
+			spec.Pointer = ptr
+			return nil
+		},
+	)
+	parser.Func(
+		"q",
+		"print every value matched by this JSONPath query, e.g. $..price",
+		func(query string) error {
+			spec.Select = true
+			spec.Query = query
+			return nil
+		},
+	)
+	parser.BoolVar(
+		&spec.Paths,
+		"paths",
+		false,
+		"print the normalized paths of query matches rather than their values",
+	)
+	parser.StringVar(
+		&spec.Patch,
+		"patch",
+		"",
+		"apply the JSON Patch in this file to the document",
+	)
+	parser.BoolVar(
+		&spec.Write,
+		"w",
+		false,
+		"write a patched document back to its file rather than to stdout",
+	)
+	parser.BoolVar(
+		&spec.Diff,
+		"diff",
+		false,
+		"show what changed between two documents",
+	)
+	parser.BoolVar(
+		&spec.DiffPatch,
+		"diff-patch",
+		false,
+		"show the differences as a JSON Patch that turns the first document into the second",
+	)
+	parser.StringVar(
+		&spec.DiffKey,
+		"diff-key",
+		"",
+		"match up array elements by the value of this member rather than by position",
+	)
+	parser.BoolVar(
+		&spec.Numeric,
+		"numeric",
+		false,
+		"treat numbers with the same value as equal when diffing, e.g. 1 and 1.0",
+	)
+	parser.BoolVar(
+		&spec.NoColor,
+		"no-color",
+		false,
+		"don't colour the diff even when writing to a terminal",
+	)
+	parser.StringVar(
+		&spec.MergePatch,
+		"merge-patch",
+		"",
+		"apply the JSON Merge Patch in this file to the document",
+	)
+	parser.BoolVar(
+		&spec.Merge,
+		"merge",
+		false,
+		"deep merge the documents, later ones taking precedence",
+	)
+	parser.StringVar(
+		&spec.Arrays,
+		"arrays",
+		string(ReplaceArrays),
+		"how to merge arrays: replace, concat or key",
+	)
+	parser.StringVar(
+		&spec.MergeKey,
+		"merge-key",
+		"",
+		"member that identifies array elements when merging arrays by key",
+	)
+	parser.BoolVar(
+		&spec.Blame,
+		"blame",
+		false,
+		"rather than the merged document, show which document set each value",
+	)
+	parser.StringVar(
+		&spec.Schema,
+		"schema",
+		"",
+		"validate the document against the JSON Schema in this file",
+	)
+	parser.BoolVar(
+		&spec.Infer,
+		"infer",
+		false,
+		"print a JSON Schema that describes all of the sample documents",
+	)
+	parser.BoolVar(
+		&spec.NDJSON,
+		"ndjson",
+		false,
+		"treat each line of the input as a document of its own (JSON Lines)",
+	)
+	parser.IntVar(
+		&spec.MaxEnum,
+		"enum",
+		5,
+		"describe strings with at most this many distinct values as an enum when inferring a schema",
+	)
+	parser.BoolVar(
+		&spec.Relaxed,
+		"json5",
+		false,
+		"accept JSON5, e.g. comments, trailing commas and unquoted keys",
+	)
+	parser.BoolVar(
+		&spec.Sequence,
+		"seq",
+		false,
+		"read a sequence of documents, either concatenated or separated by RS characters (RFC 7464)",
+	)
+	parser.StringVar(
+		&spec.Duplicates,
+		"dups",
+		string(AllowDuplicates),
+		"what to do about duplicate keys: allow, warn, error, first or last",
+	)
+	parser.BoolVar(
+		&spec.IJSON,
+		"ijson",
+		false,
+		"reject anything I-JSON (RFC 7493) doesn't allow, e.g. imprecise numbers and duplicate keys",
+	)
+	parser.BoolVar(
+		&spec.FirstError,
+		"first-error",
+		false,
+		"stop at the first error in a document rather than reporting them all",
+	)
+	parser.IntVar(
+		&spec.MaxDepth,
+		"max-depth",
+		0,
+		fmt.Sprintf("how deeply arrays and objects may nest, 0 for %d and negative for no limit", DefaultMaxDepth),
+	)
+	if err := parser.Parse(args); err != nil {
+		return Spec{}, fmt.Errorf(
+			"failed to parse arguments: %w\n%s",
+			err,
+			usage.String(),
+		)
+	}
+	if spec.Indent < 0 {
+		return Spec{}, fmt.Errorf("indent must not be negative, got %d", spec.Indent)
+	}
+	policies := []DuplicatePolicy{AllowDuplicates, WarnDuplicates, RejectDuplicates, FirstKeyWins, LastKeyWins}
+	if !slices.Contains(policies, DuplicatePolicy(spec.Duplicates)) {
+		return Spec{}, fmt.Errorf("unknown duplicate key policy %q", spec.Duplicates)
+	}
+	if spec.MaxEnum < 0 {
+		return Spec{}, fmt.Errorf("enum must not be negative, got %d", spec.MaxEnum)
+	}
+
+	if modes := spec.modes(); len(modes) > 1 {
+		return Spec{}, fmt.Errorf("%s and %s can't be used together", modes[0], modes[1])
+	}
+	if spec.Write && spec.Patch == "" && spec.MergePatch == "" {
+		return Spec{}, errors.New("-w needs -patch or -merge-patch to say how to change the document")
+	}
+
+	spec.Format = spec.Format || spec.Check
+	spec.Sources = []string{"stdin"}
+	if tail := parser.Args(); len(tail) >= 1 {
+		spec.Sources = tail
+	}
+	spec.Diff = spec.Diff || spec.DiffPatch
+	if spec.Diff && len(spec.Sources) != 2 {
+		return Spec{}, fmt.Errorf("-diff needs exactly two documents to compare, got %d", len(spec.Sources))
+	}
+	if spec.Write && slices.Contains(spec.Sources, "stdin") {
+		return Spec{}, errors.New("-w needs a file to write the document back to")
+	}
+	if spec.Write && spec.Sequence {
+		return Spec{}, errors.New("-w can't write a sequence back to its file")
+	}
+
+	return spec, nil
+}
+
+// modes names the flags given that each pick what to do with the documents,
+// of which there can only be one.
+func (s Spec) modes() []string {
+	var modes []string
+	add := func(on bool, name string) {
+		if on {
+			modes = append(modes, name)
+		}
+	}
+	add(s.Format, "-fmt")
+	add(s.Check && !s.Format, "-check")
+	add(s.Minify, "-minify")
+	add(s.Canonical, "-canon")
+	add(s.Digest && !s.Canonical, "-sha256")
+	add(s.Lookup, "-p")
+	add(s.Select, "-q")
+	add(s.Patch != "", "-patch")
+	add(s.MergePatch != "", "-merge-patch")
+	add(s.Schema != "", "-schema")
+	add(s.Diff, "-diff")
+	add(s.DiffPatch && !s.Diff, "-diff-patch")
+	add(s.Merge, "-merge")
+	add(s.Infer, "-infer")
+	return modes
+}
+
+func (s Spec) DiffOptions() DiffOptions {
+	return DiffOptions{ArrayKey: s.DiffKey, NumericEqual: s.Numeric}
+}
+
+func (s Spec) ParseOptions() Options {
+	return Options{
+		Recover:    !s.FirstError,
+		Relaxed:    s.Relaxed,
+		Sequence:   s.Sequence,
+		Duplicates: DuplicatePolicy(s.Duplicates),
+		IJSON:      s.IJSON,
+		MaxDepth:   s.MaxDepth,
+	}
+}
+
+func (s Spec) FormatOptions() FormatOptions {
+	indent := strings.Repeat(" ", s.Indent)
+	if s.Tabs {
+		indent = "\t"
+	}
+	return FormatOptions{
+		Indent:     indent,
+		SortKeys:   s.SortKeys,
+		ArrayWidth: s.ArrayWidth,
+	}
+}
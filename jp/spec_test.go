@@ -0,0 +1,269 @@
+package main_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestBadFlag(t *testing.T) {
+	_, got := jp.LoadSpec([]string{"-bad"})
+	if got == nil {
+		t.Fatalf("Got nil but wanted error")
+	}
+}
+
+func TestDiffNeedsTwoDocuments(t *testing.T) {
+	_, got := jp.LoadSpec([]string{"-diff", "a.json"})
+	if got == nil {
+		t.Fatalf("Got nil but wanted error")
+	}
+}
+
+func TestWriteNeedsFile(t *testing.T) {
+	_, got := jp.LoadSpec([]string{"-patch", "p.json", "-w"})
+	if got == nil {
+		t.Fatalf("Got nil but wanted error")
+	}
+}
+
+func TestWriteNeedsDocument(t *testing.T) {
+	_, got := jp.LoadSpec([]string{"-patch", "p.json", "-w", "-seq", "a.json"})
+	if got == nil {
+		t.Fatalf("Got nil but wanted error")
+	}
+}
+
+func TestWriteNeedsPatch(t *testing.T) {
+	_, got := jp.LoadSpec([]string{"-w", "-fmt", "a.json"})
+	if got == nil {
+		t.Fatalf("Got nil but wanted error")
+	}
+}
+
+func TestConflictingModes(t *testing.T) {
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"-minify", "-canon"}, want: "-minify and -canon can't be used together"},
+		{args: []string{"-patch", "x.json", "-merge-patch", "y.json"}, want: "-patch and -merge-patch can't be used together"},
+		{args: []string{"-check", "-minify"}, want: "-check and -minify can't be used together"},
+		{args: []string{"-sha256", "-p", "/a"}, want: "-sha256 and -p can't be used together"},
+		{args: []string{"-q", "$.a", "-schema", "s.json"}, want: "-q and -schema can't be used together"},
+		{args: []string{"-fmt", "-diff", "a.json", "b.json"}, want: "-fmt and -diff can't be used together"},
+		{args: []string{"-diff-patch", "-merge", "a.json", "b.json"}, want: "-diff-patch and -merge can't be used together"},
+		{args: []string{"-merge", "-infer"}, want: "-merge and -infer can't be used together"},
+	}
+	for _, tC := range testCases {
+		t.Run(strings.Join(tC.args, " "), func(t *testing.T) {
+			_, err := jp.LoadSpec(tC.args)
+			if err == nil || err.Error() != tC.want {
+				t.Fatalf("Bad error: got %v, want %s", err, tC.want)
+			}
+		})
+	}
+}
+
+func TestBadDuplicatePolicy(t *testing.T) {
+	_, got := jp.LoadSpec([]string{"-dups", "ignore"})
+	if got == nil {
+		t.Fatalf("Got nil but wanted error")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	testCases := []struct {
+		desc string
+		args []string
+		want jp.Spec
+	}{
+		{
+			desc: "defaults",
+			args: []string{},
+			want: jp.Spec{Sources: []string{"stdin"}, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "format",
+			args: []string{"-fmt", "-indent", "4", "-sort", "-array-width", "40", "a.json"},
+			want: jp.Spec{
+				Sources:    []string{"a.json"},
+				Format:     true,
+				Indent:     4,
+				Arrays:     "replace",
+				MaxEnum:    5,
+				Duplicates: "allow",
+				SortKeys:   true,
+				ArrayWidth: 40,
+			},
+		},
+		{
+			desc: "minify",
+			args: []string{"-minify", "big.json"},
+			want: jp.Spec{Sources: []string{"big.json"}, Minify: true, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "canonical digest",
+			args: []string{"-sha256", "-canon"},
+			want: jp.Spec{Sources: []string{"stdin"}, Canonical: true, Digest: true, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "pointer",
+			args: []string{"-p", "", "a.json"},
+			want: jp.Spec{Sources: []string{"a.json"}, Lookup: true, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "pointer with path",
+			args: []string{"-p", "/servers/0/host", "a.json"},
+			want: jp.Spec{Sources: []string{"a.json"}, Lookup: true, Pointer: "/servers/0/host", Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "query",
+			args: []string{"-q", "$..price", "-paths", "a.json"},
+			want: jp.Spec{Sources: []string{"a.json"}, Select: true, Query: "$..price", Paths: true, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "patch in place",
+			args: []string{"-patch", "p.json", "-w", "a.json"},
+			want: jp.Spec{Sources: []string{"a.json"}, Patch: "p.json", Write: true, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "diff patch",
+			args: []string{"-diff-patch", "-diff-key", "id", "-numeric", "a.json", "b.json"},
+			want: jp.Spec{
+				Sources:    []string{"a.json", "b.json"},
+				Diff:       true,
+				DiffPatch:  true,
+				DiffKey:    "id",
+				Numeric:    true,
+				Indent:     2,
+				Arrays:     "replace",
+				MaxEnum:    5,
+				Duplicates: "allow",
+			},
+		},
+		{
+			desc: "merge",
+			args: []string{"-merge", "-arrays", "key", "-merge-key", "name", "-blame", "base.json", "env.json"},
+			want: jp.Spec{
+				Sources:    []string{"base.json", "env.json"},
+				Merge:      true,
+				Arrays:     "key",
+				MaxEnum:    5,
+				Duplicates: "allow",
+				MergeKey:   "name",
+				Blame:      true,
+				Indent:     2,
+			},
+		},
+		{
+			desc: "schema",
+			args: []string{"-schema", "s.json", "a.json"},
+			want: jp.Spec{Sources: []string{"a.json"}, Schema: "s.json", Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "infer",
+			args: []string{"-infer", "-ndjson", "-enum", "3", "events.ndjson"},
+			want: jp.Spec{Sources: []string{"events.ndjson"}, Infer: true, NDJSON: true, MaxEnum: 3, Indent: 2, Arrays: "replace", Duplicates: "allow"},
+		},
+		{
+			desc: "json5",
+			args: []string{"-json5", "-fmt", "tsconfig.json"},
+			want: jp.Spec{Sources: []string{"tsconfig.json"}, Relaxed: true, Format: true, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "sequence",
+			args: []string{"-seq", "events.json-seq"},
+			want: jp.Spec{Sources: []string{"events.json-seq"}, Sequence: true, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "duplicates",
+			args: []string{"-dups", "last", "a.json"},
+			want: jp.Spec{Sources: []string{"a.json"}, Duplicates: "last", Indent: 2, Arrays: "replace", MaxEnum: 5},
+		},
+		{
+			desc: "i-json",
+			args: []string{"-ijson", "a.json"},
+			want: jp.Spec{Sources: []string{"a.json"}, IJSON: true, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "first error",
+			args: []string{"-first-error", "a.json"},
+			want: jp.Spec{Sources: []string{"a.json"}, FirstError: true, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "max depth",
+			args: []string{"-max-depth", "64", "a.json"},
+			want: jp.Spec{Sources: []string{"a.json"}, MaxDepth: 64, Indent: 2, Arrays: "replace", MaxEnum: 5, Duplicates: "allow"},
+		},
+		{
+			desc: "check implies format",
+			args: []string{"-check", "-tabs", "a.json", "b.json"},
+			want: jp.Spec{
+				Sources:    []string{"a.json", "b.json"},
+				Format:     true,
+				Check:      true,
+				Tabs:       true,
+				Indent:     2,
+				Arrays:     "replace",
+				MaxEnum:    5,
+				Duplicates: "allow",
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := jp.LoadSpec(tC.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("Bad spec: got %+v, want %+v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestSpecParseOptions(t *testing.T) {
+	testCases := []struct {
+		desc string
+		spec jp.Spec
+		want jp.Options
+	}{
+		{desc: "defaults", spec: jp.Spec{Duplicates: "allow"}, want: jp.Options{Recover: true, Duplicates: jp.AllowDuplicates}},
+		{desc: "first error", spec: jp.Spec{Duplicates: "allow", FirstError: true}, want: jp.Options{Duplicates: jp.AllowDuplicates}},
+		{desc: "max depth", spec: jp.Spec{Duplicates: "allow", MaxDepth: 3}, want: jp.Options{Recover: true, Duplicates: jp.AllowDuplicates, MaxDepth: 3}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := tC.spec.ParseOptions(); got != tC.want {
+				t.Fatalf("Bad options: got %+v, want %+v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestSpecFormatOptions(t *testing.T) {
+	testCases := []struct {
+		desc string
+		spec jp.Spec
+		want jp.FormatOptions
+	}{
+		{desc: "spaces", spec: jp.Spec{Indent: 3}, want: jp.FormatOptions{Indent: "   "}},
+		{desc: "tabs", spec: jp.Spec{Indent: 3, Tabs: true}, want: jp.FormatOptions{Indent: "\t"}},
+		{
+			desc: "everything",
+			spec: jp.Spec{Indent: 1, SortKeys: true, ArrayWidth: 20},
+			want: jp.FormatOptions{Indent: " ", SortKeys: true, ArrayWidth: 20},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := tC.spec.FormatOptions(); got != tC.want {
+				t.Fatalf("Bad options: got %+v, want %+v", got, tC.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,36 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"unicode/utf8"
+)
 
 type TokenType string
 
+// Position is a location in the input. Offset is in bytes from the start of
+// the input, Line and Col count from 1 and Col is measured in runes.
+type Position struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Col)
+}
+
+// Token is a single lexical element spanning Start up to, but not including,
+// End. For STRING tokens Literal holds the raw text between the quotes and
+// Value holds the decoded string. NUM tokens read in relaxed mode hold the
+// number rewritten as JSON in Value. For ILLEGAL tokens End marks the
+// character that could not be lexed and Err says why.
 type Token struct {
 	Type    TokenType
 	Literal string
-	line    int
+	Value   string
+	Start   Position
+	End     Position
+	Err     error
 }
 
 const (
@@ -19,6 +42,7 @@ const (
 	RBRCKT = "]"
 	COLON  = ":"
 	COMMA  = ","
+	RS     = "RS"
 
 	IDENT  = "IDENT"
 	STRING = "STRING"
@@ -31,12 +55,21 @@ const (
 	ILLEGAL = "ILLEGAL"
 )
 
-func NewTokenFromRune(tt TokenType, r rune, line int) Token {
-	return Token{Type: tt, Literal: string(r), line: line}
+func NewTokenFromRune(tt TokenType, r rune, start Position) Token {
+	end := Position{
+		Offset: start.Offset + utf8.RuneLen(r),
+		Line:   start.Line,
+		Col:    start.Col + 1,
+	}
+	return Token{Type: tt, Literal: string(r), Start: start, End: end}
 }
 
-func NewTokenFromString(tt TokenType, s string, line int) Token {
-	return Token{Type: tt, Literal: s, line: line}
+func NewTokenFromString(tt TokenType, s string, start, end Position) Token {
+	return Token{Type: tt, Literal: s, Start: start, End: end}
+}
+
+func NewStringToken(raw, val string, start, end Position) Token {
+	return Token{Type: STRING, Literal: raw, Value: val, Start: start, End: end}
 }
 
 func (t Token) String() string {
@@ -44,7 +77,25 @@ func (t Token) String() string {
 	if string(t.Type) != t.Literal {
 		lit = fmt.Sprintf("(%s)", t.Literal)
 	}
-	return fmt.Sprintf("Line %d: %s\t%s", t.line, t.Type, lit)
+	return fmt.Sprintf("%d:%d: %s\t%s", t.Start.Line, t.Start.Col, t.Type, lit)
+}
+
+// describe names the token for use in error messages.
+func (t Token) describe() string {
+	switch {
+	case t.Type == ILLEGAL:
+		return t.Literal
+	case t.Type == EOF:
+		return "end of input"
+	case t.Type == RS:
+		return "record separator"
+	case string(t.Type) == t.Literal:
+		return fmt.Sprintf("'%s'", t.Literal)
+	case t.Type == STRING:
+		return fmt.Sprintf("%s(\"%s\")", t.Type, t.Literal)
+	default:
+		return fmt.Sprintf("%s(%s)", t.Type, t.Literal)
+	}
 }
 
 var keywords = map[string]TokenType{
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// UnmarshalError says which value of a document couldn't be stored in the Go
+// value it was being unmarshalled into. Err, if set, says why.
+type UnmarshalError struct {
+	Path Pointer
+	Pos  Position
+	Kind Kind
+	Type reflect.Type
+	Err  error
+}
+
+func (e *UnmarshalError) Error() string {
+	var buf strings.Builder
+	if e.Pos.Line > 0 {
+		fmt.Fprintf(&buf, "%s: ", e.Pos)
+	}
+	fmt.Fprintf(&buf, "%s: cannot unmarshal %s into %s", describePath(e.Path), e.Kind, e.Type)
+	if e.Err != nil {
+		fmt.Fprintf(&buf, ": %s", e.Err)
+	}
+	return buf.String()
+}
+
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	nodeType   = reflect.TypeFor[Value]()
+	numberType = reflect.TypeFor[Number]()
+)
+
+// genericTypes are what values are stored as when unmarshalled into an empty
+// interface.
+var genericTypes = map[Kind]reflect.Type{
+	BoolKind:   reflect.TypeFor[bool](),
+	NumberKind: reflect.TypeFor[float64](),
+	StringKind: reflect.TypeFor[string](),
+	ArrayKind:  reflect.TypeFor[[]any](),
+	ObjectKind: reflect.TypeFor[map[string]any](),
+}
+
+// Unmarshal parses data and stores the document in the value v points to,
+// following the same rules as encoding/json: struct fields are matched by the
+// name in their json tag or else their own, ignoring case if need be, and
+// members without a field are skipped. Strings are unmarshalled into types
+// implementing encoding.TextUnmarshaler by calling it and into []byte by
+// decoding them as base64. A Value or Number is set to the document's own
+// node. Unmarshalling stops at the first value that doesn't fit, returning an
+// UnmarshalError saying where it is.
+func Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("unmarshal needs a non-nil pointer, got %T", v)
+	}
+
+	p := NewParserWithOptions(bytes.NewReader(data), Options{TrackPositions: true})
+	doc, err := p.Parse()
+	if err != nil {
+		return err
+	}
+	d := decoder{pos: p.Positions()}
+	return d.decode(doc, rv.Elem(), Pointer{})
+}
+
+type decoder struct {
+	pos Positions
+}
+
+func (d *decoder) fail(v Value, t reflect.Type, path Pointer, err error) *UnmarshalError {
+	return &UnmarshalError{Path: slices.Clone(path), Pos: d.pos[v], Kind: v.Kind(), Type: t, Err: err}
+}
+
+func (d *decoder) decode(v Value, rv reflect.Value, path Pointer) error {
+	if rv.Type() == nodeType {
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if _, ok := v.(*Null); ok {
+		switch rv.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice:
+			rv.SetZero()
+		}
+		return nil
+	}
+
+	rv, tu := indirect(rv)
+	if s, ok := v.(*String); ok && tu != nil {
+		if err := tu.UnmarshalText([]byte(s.Value)); err != nil {
+			return d.fail(v, rv.Type(), path, err)
+		}
+		return nil
+	}
+	if n, ok := v.(*Number); ok && rv.Type() == numberType {
+		rv.Set(reflect.ValueOf(*n))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface:
+		return d.decodeInterface(v, rv, path)
+	case reflect.Bool:
+		b, ok := v.(*Bool)
+		if !ok {
+			return d.fail(v, rv.Type(), path, nil)
+		}
+		rv.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return d.decodeInt(v, rv, path)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return d.decodeUint(v, rv, path)
+	case reflect.Float32, reflect.Float64:
+		return d.decodeFloat(v, rv, path)
+	case reflect.String:
+		s, ok := v.(*String)
+		if !ok {
+			return d.fail(v, rv.Type(), path, nil)
+		}
+		rv.SetString(s.Value)
+	case reflect.Slice:
+		return d.decodeSlice(v, rv, path)
+	case reflect.Array:
+		return d.decodeArray(v, rv, path)
+	case reflect.Map:
+		return d.decodeMap(v, rv, path)
+	case reflect.Struct:
+		return d.decodeStruct(v, rv, path)
+	default:
+		return d.fail(v, rv.Type(), path, nil)
+	}
+	return nil
+}
+
+// indirect follows pointers down to the value they point at, allocating any
+// that are nil, stopping early at one that is a TextUnmarshaler.
+func indirect(rv reflect.Value) (reflect.Value, encoding.TextUnmarshaler) {
+	for {
+		if rv.Kind() != reflect.Pointer && rv.CanAddr() {
+			if tu, ok := rv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+				return rv, tu
+			}
+		}
+		if rv.Kind() != reflect.Pointer {
+			return rv, nil
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		if tu, ok := rv.Interface().(encoding.TextUnmarshaler); ok {
+			return rv, tu
+		}
+		rv = rv.Elem()
+	}
+}
+
+func (d *decoder) decodeInterface(v Value, rv reflect.Value, path Pointer) error {
+	if rv.NumMethod() > 0 {
+		return d.fail(v, rv.Type(), path, nil)
+	}
+	generic := reflect.New(genericTypes[v.Kind()]).Elem()
+	if err := d.decode(v, generic, path); err != nil {
+		return err
+	}
+	rv.Set(generic)
+	return nil
+}
+
+func (d *decoder) decodeInt(v Value, rv reflect.Value, path Pointer) error {
+	n, ok := v.(*Number)
+	if !ok {
+		return d.fail(v, rv.Type(), path, nil)
+	}
+	i, err := n.Int64()
+	if err == nil && rv.OverflowInt(i) {
+		err = &NumberError{n.Literal, rv.Type().String(), ErrNumberRange}
+	}
+	if err != nil {
+		return d.fail(v, rv.Type(), path, err)
+	}
+	rv.SetInt(i)
+	return nil
+}
+
+func (d *decoder) decodeUint(v Value, rv reflect.Value, path Pointer) error {
+	n, ok := v.(*Number)
+	if !ok {
+		return d.fail(v, rv.Type(), path, nil)
+	}
+	u, err := n.Uint64()
+	if err == nil && rv.OverflowUint(u) {
+		err = &NumberError{n.Literal, rv.Type().String(), ErrNumberRange}
+	}
+	if err != nil {
+		return d.fail(v, rv.Type(), path, err)
+	}
+	rv.SetUint(u)
+	return nil
+}
+
+// decodeFloat stores the nearest float to the number, as losing precision is
+// expected of floats.
+func (d *decoder) decodeFloat(v Value, rv reflect.Value, path Pointer) error {
+	n, ok := v.(*Number)
+	if !ok {
+		return d.fail(v, rv.Type(), path, nil)
+	}
+	f, err := n.Float64()
+	if errors.Is(err, ErrNumberPrecision) {
+		err = nil
+	}
+	if err == nil && rv.OverflowFloat(f) {
+		err = &NumberError{n.Literal, rv.Type().String(), ErrNumberRange}
+	}
+	if err != nil {
+		return d.fail(v, rv.Type(), path, err)
+	}
+	rv.SetFloat(f)
+	return nil
+}
+
+func (d *decoder) decodeSlice(v Value, rv reflect.Value, path Pointer) error {
+	if s, ok := v.(*String); ok && rv.Type().Elem().Kind() == reflect.Uint8 {
+		b, err := base64.StdEncoding.DecodeString(s.Value)
+		if err != nil {
+			return d.fail(v, rv.Type(), path, err)
+		}
+		rv.SetBytes(b)
+		return nil
+	}
+
+	arr, ok := v.(*Array)
+	if !ok {
+		return d.fail(v, rv.Type(), path, nil)
+	}
+	elems := reflect.MakeSlice(rv.Type(), len(arr.Elems), len(arr.Elems))
+	for i, e := range arr.Elems {
+		if err := d.decode(e, elems.Index(i), append(path, strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	rv.Set(elems)
+	return nil
+}
+
+// decodeArray fills a Go array from the start, zeroing any elements left over
+// and ignoring any extra values.
+func (d *decoder) decodeArray(v Value, rv reflect.Value, path Pointer) error {
+	arr, ok := v.(*Array)
+	if !ok {
+		return d.fail(v, rv.Type(), path, nil)
+	}
+	for i := range rv.Len() {
+		if i >= len(arr.Elems) {
+			rv.Index(i).SetZero()
+			continue
+		}
+		if err := d.decode(arr.Elems[i], rv.Index(i), append(path, strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeMap adds the members of an object to a map. Keys must be strings,
+// integers or implement encoding.TextUnmarshaler, with strings taking
+// precedence.
+func (d *decoder) decodeMap(v Value, rv reflect.Value, path Pointer) error {
+	obj, ok := v.(*Object)
+	if !ok {
+		return d.fail(v, rv.Type(), path, nil)
+	}
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMap(rv.Type()))
+	}
+
+	kt, et := rv.Type().Key(), rv.Type().Elem()
+	for _, m := range obj.Members {
+		key, err := mapKey(kt, m.Key)
+		if err != nil {
+			return d.fail(v, rv.Type(), append(path, m.Key), err)
+		}
+		elem := reflect.New(et).Elem()
+		if err := d.decode(m.Value, elem, append(path, m.Key)); err != nil {
+			return err
+		}
+		rv.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+func mapKey(t reflect.Type, name string) (reflect.Value, error) {
+	key := reflect.New(t)
+	if tu, ok := key.Interface().(encoding.TextUnmarshaler); ok && t.Kind() != reflect.String {
+		return key.Elem(), tu.UnmarshalText([]byte(name))
+	}
+
+	key = key.Elem()
+	switch t.Kind() {
+	case reflect.String:
+		key.SetString(name)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(name, 10, 64)
+		if err != nil || key.OverflowInt(i) {
+			return key, fmt.Errorf("key %q is not a %s", name, t)
+		}
+		key.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || key.OverflowUint(u) {
+			return key, fmt.Errorf("key %q is not a %s", name, t)
+		}
+		key.SetUint(u)
+	default:
+		return key, fmt.Errorf("unsupported map key type %s", t)
+	}
+	return key, nil
+}
+
+func (d *decoder) decodeStruct(v Value, rv reflect.Value, path Pointer) error {
+	obj, ok := v.(*Object)
+	if !ok {
+		return d.fail(v, rv.Type(), path, nil)
+	}
+
+	fields := structFields(rv.Type())
+	for _, m := range obj.Members {
+		f, ok := lookupField(fields, m.Key)
+		if !ok {
+			continue
+		}
+		fv, err := fieldByIndex(rv, f.index)
+		if err != nil {
+			return d.fail(v, rv.Type(), append(path, m.Key), err)
+		}
+		if f.quoted {
+			err = d.decodeQuoted(m.Value, fv, append(path, m.Key))
+		} else {
+			err = d.decode(m.Value, fv, append(path, m.Key))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex finds a possibly promoted field, allocating any embedded
+// structs it is reached through that are nil.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				if !rv.CanSet() {
+					return rv, fmt.Errorf("cannot set embedded pointer to unexported struct %s", rv.Type().Elem())
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, nil
+}
+
+// decodeQuoted unmarshals a field tagged with the string option, whose value
+// is held as JSON text inside a string.
+func (d *decoder) decodeQuoted(v Value, rv reflect.Value, path Pointer) error {
+	if _, ok := v.(*Null); ok {
+		return nil
+	}
+	s, ok := v.(*String)
+	if !ok {
+		return d.fail(v, rv.Type(), path, errors.New("string tag needs a string"))
+	}
+
+	p := NewParser(strings.NewReader(s.Value))
+	inner, err := p.Parse()
+	if err == nil && (inner.Kind() == ArrayKind || inner.Kind() == ObjectKind) {
+		err = fmt.Errorf("%s is not a scalar", inner.Kind())
+	}
+	if err != nil {
+		return d.fail(v, rv.Type(), path, fmt.Errorf("string tag needs JSON text in the string, got %q: %w", s.Value, err))
+	}
+	d.pos[inner] = d.pos[v]
+	return d.decode(inner, rv, path)
+}
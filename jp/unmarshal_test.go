@@ -0,0 +1,287 @@
+package main_test
+
+import (
+	"errors"
+	"math"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+type Base struct {
+	ID      int `json:"id"`
+	Created time.Time
+}
+
+type Meta struct {
+	Owner string
+	Tags  []string `json:"tags"`
+}
+
+type labels struct {
+	Colour string `json:"colour"`
+}
+
+type Server struct {
+	Base
+	*Meta
+	labels
+	Name    string            `json:"name"`
+	Port    uint16            `json:"port,omitempty"`
+	Weight  float32           `json:"weight"`
+	Count   int64             `json:"count,string"`
+	Enabled *bool             `json:"enabled"`
+	Addr    netip.Addr        `json:"addr"`
+	Env     map[string]string `json:"env"`
+	Extra   any               `json:"extra"`
+	Raw     jp.Value          `json:"raw"`
+	Size    jp.Number         `json:"size"`
+	Secret  string            `json:"-"`
+	hidden  string
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	data := `{
+		"id": 7,
+		"Created": "2024-05-01T10:00:00Z",
+		"owner": "ops",
+		"tags": ["a", "b"],
+		"colour": "blue",
+		"name": "web",
+		"port": 8080,
+		"weight": 0.5,
+		"count": "12",
+		"enabled": true,
+		"addr": "10.0.0.1",
+		"env": {"A": "1"},
+		"extra": {"n": [1, "two", null, false]},
+		"raw": [1, 2],
+		"size": 123456789012345678901234567890,
+		"Secret": "no",
+		"hidden": "no",
+		"unknown": 1
+	}`
+	enabled := true
+	want := Server{
+		Base:    Base{ID: 7, Created: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		Meta:    &Meta{Owner: "ops", Tags: []string{"a", "b"}},
+		labels:  labels{Colour: "blue"},
+		Name:    "web",
+		Port:    8080,
+		Weight:  0.5,
+		Count:   12,
+		Enabled: &enabled,
+		Addr:    netip.MustParseAddr("10.0.0.1"),
+		Env:     map[string]string{"A": "1"},
+		Extra:   map[string]any{"n": []any{1.0, "two", nil, false}},
+		Raw:     &jp.Array{Elems: []jp.Value{&jp.Number{Literal: "1"}, &jp.Number{Literal: "2"}}},
+		Size:    jp.Number{Literal: "123456789012345678901234567890"},
+	}
+
+	var got Server
+	if err := jp.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bad struct: got %+v, want %+v", got, want)
+	}
+}
+
+type Outer struct {
+	Inner
+	Name string `json:"name"`
+}
+
+type Inner struct {
+	Name string `json:"name"`
+	Note string
+}
+
+type left struct {
+	Shared string
+}
+
+type right struct {
+	Shared string
+}
+
+type Ambiguous struct {
+	left
+	right
+}
+
+type Tagged struct {
+	left
+	Named right `json:"-"`
+	right2
+}
+
+type right2 struct {
+	Shared string `json:"Shared"`
+}
+
+func TestUnmarshalEmbedded(t *testing.T) {
+	var outer Outer
+	if err := jp.Unmarshal([]byte(`{"name": "outer", "Note": "inner"}`), &outer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := (Outer{Inner: Inner{Note: "inner"}, Name: "outer"}); outer != want {
+		t.Fatalf("Bad shallower field: got %+v, want %+v", outer, want)
+	}
+
+	var ambiguous Ambiguous
+	if err := jp.Unmarshal([]byte(`{"Shared": "x"}`), &ambiguous); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ambiguous != (Ambiguous{}) {
+		t.Fatalf("Bad ambiguous field: got %+v, want it ignored", ambiguous)
+	}
+
+	var tagged Tagged
+	if err := jp.Unmarshal([]byte(`{"Shared": "x"}`), &tagged); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := (Tagged{right2: right2{Shared: "x"}}); tagged != want {
+		t.Fatalf("Bad tagged field: got %+v, want %+v", tagged, want)
+	}
+}
+
+func TestUnmarshalValues(t *testing.T) {
+	testCases := []struct {
+		desc string
+		data string
+		into any
+		want any
+	}{
+		{desc: "int", data: `-12`, into: new(int), want: -12},
+		{desc: "exponent int", data: `1.5e2`, into: new(int16), want: int16(150)},
+		{desc: "max uint", data: `18446744073709551615`, into: new(uint64), want: uint64(math.MaxUint64)},
+		{desc: "float", data: `0.1`, into: new(float64), want: 0.1},
+		{desc: "imprecise float", data: `0.10000000000000000001`, into: new(float64), want: 0.1},
+		{desc: "string", data: `"hé"`, into: new(string), want: "hé"},
+		{desc: "bytes", data: `"aGk="`, into: new([]byte), want: []byte("hi")},
+		{desc: "slice", data: `[1, 2]`, into: new([]int), want: []int{1, 2}},
+		{desc: "empty slice", data: `[]`, into: new([]int), want: []int{}},
+		{desc: "short array", data: `[1]`, into: &[3]int{9, 9, 9}, want: [3]int{1, 0, 0}},
+		{desc: "long array", data: `[1, 2, 3]`, into: new([2]int), want: [2]int{1, 2}},
+		{desc: "int keys", data: `{"1": "a", "-2": "b"}`, into: new(map[int]string), want: map[int]string{1: "a", -2: "b"}},
+		{desc: "text keys", data: `{"::1": 1}`, into: new(map[netip.Addr]int), want: map[netip.Addr]int{netip.MustParseAddr("::1"): 1}},
+		{desc: "map merges", data: `{"b": 2}`, into: &map[string]int{"a": 1}, want: map[string]int{"a": 1, "b": 2}},
+		{desc: "null pointer", data: `null`, into: func() any { p := new(int); return &p }(), want: (*int)(nil)},
+		{desc: "null int", data: `null`, into: func() any { i := 4; return &i }(), want: 4},
+		{desc: "pointer to pointer", data: `5`, into: new(**int), want: func() **int { i := 5; p := &i; return &p }()},
+		{desc: "any", data: `[{"a": true}]`, into: new(any), want: []any{map[string]any{"a": true}}},
+		{desc: "quoted string", data: `{"s": "\"x\""}`, into: new(quoted), want: quoted{S: "x"}},
+		{desc: "quoted bool", data: `{"b": "true"}`, into: new(quoted), want: quoted{B: true}},
+		{desc: "quoted null", data: `{"i": null}`, into: &quoted{I: 3}, want: quoted{I: 3}},
+		{desc: "case insensitive", data: `{"S": "\"y\""}`, into: new(quoted), want: quoted{S: "y"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if err := jp.Unmarshal([]byte(tC.data), tC.into); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := reflect.ValueOf(tC.into).Elem().Interface(); !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("Bad value: got %#v, want %#v", got, tC.want)
+			}
+		})
+	}
+}
+
+type quoted struct {
+	S string `json:"s,string"`
+	B bool   `json:"b,string"`
+	I int    `json:"i,string"`
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		data  string
+		into  any
+		err   string
+		cause error
+	}{
+		{
+			desc: "wrong kind",
+			data: "{\n  \"servers\": [\n    {\"port\": \"80\"}\n  ]\n}",
+			into: new(struct {
+				Servers []struct {
+					Port int `json:"port"`
+				} `json:"servers"`
+			}),
+			err: "line 3, column 14: /servers/0/port: cannot unmarshal string into int",
+		},
+		{
+			desc:  "overflow",
+			data:  `[1, 300]`,
+			into:  new([]int8),
+			err:   "line 1, column 5: /1: cannot unmarshal number into int8: cannot convert 300 to int8: number out of range",
+			cause: jp.ErrNumberRange,
+		},
+		{
+			desc:  "fraction",
+			data:  `{"a": 1.5}`,
+			into:  new(map[string]int),
+			err:   "line 1, column 7: /a: cannot unmarshal number into int: cannot convert 1.5 to int64: number would lose precision",
+			cause: jp.ErrNumberPrecision,
+		},
+		{
+			desc:  "negative uint",
+			data:  `-1`,
+			into:  new(uint),
+			err:   "line 1, column 1: (root): cannot unmarshal number into uint",
+			cause: jp.ErrNumberRange,
+		},
+		{
+			desc:  "float32 overflow",
+			data:  `1e300`,
+			into:  new(float32),
+			err:   "cannot unmarshal number into float32",
+			cause: jp.ErrNumberRange,
+		},
+		{desc: "text", data: `{"addr": "nope"}`, into: new(Server), err: "line 1, column 10: /addr: cannot unmarshal string into netip.Addr"},
+		{desc: "bad key", data: `{"x": 1}`, into: new(map[int]int), err: `/x: cannot unmarshal object into map[int]int: key "x" is not a int`},
+		{desc: "interface", data: `1`, into: new(error), err: "cannot unmarshal number into error"},
+		{desc: "quoted number", data: `{"i": 1}`, into: new(quoted), err: "/i: cannot unmarshal number into int: string tag needs a string"},
+		{desc: "quoted nonsense", data: `{"i": "x"}`, into: new(quoted), err: `/i: cannot unmarshal string into int: string tag needs JSON text in the string, got "x"`},
+		{desc: "base64", data: `"!!"`, into: new([]byte), err: "cannot unmarshal string into []uint8: illegal base64"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := jp.Unmarshal([]byte(tC.data), tC.into)
+			var uerr *jp.UnmarshalError
+			if !errors.As(err, &uerr) {
+				t.Fatalf("Bad error: got %v, want an UnmarshalError", err)
+			}
+			if !strings.Contains(err.Error(), tC.err) {
+				t.Fatalf("Bad message: got %q, want %q", err.Error(), tC.err)
+			}
+			if tC.cause != nil && !errors.Is(err, tC.cause) {
+				t.Fatalf("Bad cause: got %v, want %v", err, tC.cause)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBadTarget(t *testing.T) {
+	var i int
+	for _, into := range []any{nil, i, (*int)(nil)} {
+		if err := jp.Unmarshal([]byte(`1`), into); err == nil {
+			t.Fatalf("Got nil but wanted error for %T", into)
+		}
+	}
+}
+
+func TestUnmarshalSyntaxError(t *testing.T) {
+	var v any
+	err := jp.Unmarshal([]byte(`[1,`), &v)
+	var perr *jp.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Bad error: got %v, want a ParseError", err)
+	}
+}
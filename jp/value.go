@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+)
+
+type Kind string
+
+const (
+	NullKind   Kind = "null"
+	BoolKind   Kind = "boolean"
+	NumberKind Kind = "number"
+	StringKind Kind = "string"
+	ArrayKind  Kind = "array"
+	ObjectKind Kind = "object"
+)
+
+// Value is a node in a parsed JSON document. The concrete type is one of
+// *Null, *Bool, *Number, *String, *Array or *Object.
+type Value interface {
+	Kind() Kind
+}
+
+type Null struct{}
+
+type Bool struct {
+	Value bool
+}
+
+// Number keeps the literal text of the number as it appeared in the source so
+// that no precision is lost until the caller decides how to interpret it.
+type Number struct {
+	Literal string
+}
+
+type String struct {
+	Value string
+}
+
+type Array struct {
+	Elems []Value
+}
+
+// Object keeps its members in source order so a document can be written back
+// out in the same shape it was read.
+type Object struct {
+	Members []Member
+}
+
+type Member struct {
+	Key   string
+	Value Value
+}
+
+func (*Null) Kind() Kind   { return NullKind }
+func (*Bool) Kind() Kind   { return BoolKind }
+func (*Number) Kind() Kind { return NumberKind }
+func (*String) Kind() Kind { return StringKind }
+func (*Array) Kind() Kind  { return ArrayKind }
+func (*Object) Kind() Kind { return ObjectKind }
+
+func (a *Array) Len() int {
+	return len(a.Elems)
+}
+
+func (o *Object) Len() int {
+	return len(o.Members)
+}
+
+// Get returns the value of the last member named key.
+func (o *Object) Get(key string) (Value, bool) {
+	if i := o.index(key); i >= 0 {
+		return o.Members[i].Value, true
+	}
+	return nil, false
+}
+
+// Set replaces the value of the member named key, appending a new member if
+// there isn't one.
+func (o *Object) Set(key string, v Value) {
+	if i := o.index(key); i >= 0 {
+		o.Members[i].Value = v
+		return
+	}
+	o.Members = append(o.Members, Member{Key: key, Value: v})
+}
+
+// Delete removes every member named key and reports whether there were any.
+func (o *Object) Delete(key string) bool {
+	kept := o.Members[:0]
+	for _, m := range o.Members {
+		if m.Key != key {
+			kept = append(kept, m)
+		}
+	}
+	found := len(kept) != len(o.Members)
+	clear(o.Members[len(kept):])
+	o.Members = kept
+
+	return found
+}
+
+func (o *Object) Keys() []string {
+	keys := make([]string, 0, len(o.Members))
+	for _, m := range o.Members {
+		keys = append(keys, m.Key)
+	}
+	return keys
+}
+
+func (o *Object) index(key string) int {
+	for i := len(o.Members) - 1; i >= 0; i-- {
+		if o.Members[i].Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Equal reports whether two values hold the same JSON data. Numbers are
+// compared by value, so 1, 1.0 and 10e-1 are all equal, and object members
+// are compared regardless of their order.
+func Equal(a, b Value) bool {
+	switch a := a.(type) {
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Bool:
+		b, ok := b.(*Bool)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Number:
+		b, ok := b.(*Number)
+		return ok && compareNumbers(a, b) == 0
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elems) != len(b.Elems) {
+			return false
+		}
+		for i := range a.Elems {
+			if !Equal(a.Elems[i], b.Elems[i]) {
+				return false
+			}
+		}
+		return true
+	case *Object:
+		b, ok := b.(*Object)
+		if !ok || len(a.Members) != len(b.Members) {
+			return false
+		}
+		for _, m := range a.Members {
+			bv, ok := b.Get(m.Key)
+			if !ok || !Equal(m.Value, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compareNumbers orders two numbers by value. Literals are exact decimals so
+// comparing them as rationals never loses precision.
+func compareNumbers(a, b *Number) int {
+	x, okx := new(big.Rat).SetString(a.Literal)
+	y, oky := new(big.Rat).SetString(b.Literal)
+	if !okx || !oky {
+		return strings.Compare(a.Literal, b.Literal)
+	}
+	return x.Cmp(y)
+}
+
+// Clone returns a deep copy of v that shares nothing with it.
+func Clone(v Value) Value {
+	switch v := v.(type) {
+	case *Null:
+		return &Null{}
+	case *Bool:
+		return &Bool{Value: v.Value}
+	case *Number:
+		return &Number{Literal: v.Literal}
+	case *String:
+		return &String{Value: v.Value}
+	case *Array:
+		elems := make([]Value, len(v.Elems))
+		for i, e := range v.Elems {
+			elems[i] = Clone(e)
+		}
+		return &Array{Elems: elems}
+	case *Object:
+		members := make([]Member, len(v.Members))
+		for i, m := range v.Members {
+			members[i] = Member{Key: m.Key, Value: Clone(m.Value)}
+		}
+		return &Object{Members: members}
+	}
+	return v
+}
@@ -0,0 +1,38 @@
+package main_test
+
+import (
+	"reflect"
+	"testing"
+
+	jp "github.com/nuchs/ccjp"
+)
+
+func TestObjectMembers(t *testing.T) {
+	obj := &jp.Object{}
+	obj.Set("a", &jp.Number{Literal: "1"})
+	obj.Set("b", &jp.Number{Literal: "2"})
+	obj.Set("a", &jp.Number{Literal: "3"})
+
+	if got, want := obj.Keys(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bad keys: got %v, want %v", got, want)
+	}
+	got, ok := obj.Get("a")
+	if !ok {
+		t.Fatalf("Missing key %q", "a")
+	}
+	if want := (&jp.Number{Literal: "3"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bad value: got %#v, want %#v", got, want)
+	}
+	if !obj.Delete("a") {
+		t.Fatalf("Delete reported key %q missing", "a")
+	}
+	if _, ok := obj.Get("a"); ok {
+		t.Fatalf("Key %q still present after delete", "a")
+	}
+	if obj.Delete("a") {
+		t.Fatalf("Delete reported key %q present twice", "a")
+	}
+	if obj.Len() != 1 {
+		t.Fatalf("Bad length: got %d, want 1", obj.Len())
+	}
+}